@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/caquillo07/graphql-server-demo/conf"
+	"github.com/caquillo07/graphql-server-demo/pkg/auth"
+	"github.com/caquillo07/graphql-server-demo/pkg/model"
+)
+
+func init() {
+	apiKeyCmd := &cobra.Command{
+		Use:   "apikey",
+		Short: "Manage the API keys used by services",
+	}
+
+	createCmd := &cobra.Command{
+		Use:   "create",
+		Short: "Create an API key, its secret is only printed once",
+		Args:  cobra.NoArgs,
+		Run:   runAPIKeyCreateCommand,
+	}
+	createCmd.Flags().String("name", "", "who the key is given to")
+	createCmd.Flags().StringSlice("scope", nil, "role granted to the key, can be repeated")
+	createCmd.Flags().Duration("expires-in", 0, "how long the key is valid for, it never expires when 0")
+	_ = createCmd.MarkFlagRequired("name")
+
+	apiKeyCmd.AddCommand(
+		createCmd,
+		&cobra.Command{
+			Use:   "list",
+			Short: "List the API keys",
+			Args:  cobra.NoArgs,
+			Run:   runAPIKeyListCommand,
+		},
+		&cobra.Command{
+			Use:   "revoke <id>",
+			Short: "Revoke an API key",
+			Args:  cobra.ExactArgs(1),
+			Run:   runAPIKeyRevokeCommand,
+		},
+	)
+	rootCmd.AddCommand(apiKeyCmd)
+}
+
+func runAPIKeyCreateCommand(cmd *cobra.Command, args []string) {
+	name, _ := cmd.Flags().GetString("name")
+	scopes, _ := cmd.Flags().GetStringSlice("scope")
+	expiresIn, _ := cmd.Flags().GetDuration("expires-in")
+
+	key, prefix, hash, err := auth.GenerateAPIKey()
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	apiKey := &model.APIKey{
+		Name:   name,
+		Prefix: prefix,
+		Hash:   hash,
+		Scopes: scopes,
+	}
+	if expiresIn > 0 {
+		expiresAt := time.Now().Add(expiresIn)
+		apiKey.ExpiresAt = &expiresAt
+	}
+	if err := apiKeyRepository().CreateAPIKey(context.Background(), apiKey); err != nil {
+		log.Fatalln(err)
+	}
+
+	fmt.Printf("created api key %s\n", apiKey.ID)
+	fmt.Printf("secret: %s\n", key)
+	fmt.Println("store the secret now, it cannot be shown again")
+}
+
+func runAPIKeyListCommand(cmd *cobra.Command, args []string) {
+	keys, err := apiKeyRepository().ListAPIKeys(context.Background())
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tPREFIX\tSCOPES\tEXPIRES\tLAST USED\tREVOKED")
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			k.ID, k.Name, k.Prefix, strings.Join(k.Scopes, ","),
+			formatTime(k.ExpiresAt), formatTime(k.LastUsedAt), formatTime(k.RevokedAt))
+	}
+	_ = w.Flush()
+}
+
+func runAPIKeyRevokeCommand(cmd *cobra.Command, args []string) {
+	id, err := uuid.FromString(args[0])
+	if err != nil {
+		log.Fatalln("invalid api key id")
+	}
+	if err := apiKeyRepository().RevokeAPIKey(context.Background(), id); err != nil {
+		log.Fatalln(err)
+	}
+	fmt.Printf("revoked api key %s\n", id)
+}
+
+// apiKeyRepository opens the configured database, API keys are of no use
+// in the in-memory store since it does not outlive the command.
+func apiKeyRepository() model.APIKeyRepository {
+	config, err := conf.LoadConfig(viper.GetViper())
+	if err != nil {
+		log.Fatalln(err)
+	}
+	db, err := openDatabase(config)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if db == nil {
+		log.Fatalln("database.url is not configured")
+	}
+	return model.NewPostgresAPIKeyRepository(db)
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
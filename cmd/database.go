@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"database/sql"
+
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+
+	"github.com/caquillo07/graphql-server-demo/conf"
+	"github.com/caquillo07/graphql-server-demo/pkg/tracing"
+)
+
+func init() {
+	// statements run through this driver are traced when the context they
+	// run with has a span
+	sql.Register("postgres-traced", tracing.WrapDriver(&pq.Driver{}))
+}
+
+// openDatabase connects to the configured database, it returns a nil
+// database when none is configured so the in-memory store is used.
+func openDatabase(config conf.Config) (*gorm.DB, error) {
+	if config.Database.URL == "" {
+		return nil, nil
+	}
+	sqlDB, err := sql.Open("postgres-traced", config.Database.URL)
+	if err != nil {
+		return nil, err
+	}
+	db, err := gorm.Open("postgres", sqlDB)
+	if err != nil {
+		sqlDB.Close()
+		return nil, err
+	}
+	return db, nil
+}
@@ -24,6 +24,14 @@ func runGQLCommand(cmd *cobra.Command, args []string) {
 		log.Fatalln(err)
 	}
 
-	s := server.NewGQLServer(config)
+	db, err := openDatabase(config)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	s, err := server.NewGQLServer(config, db)
+	if err != nil {
+		log.Fatalln(err)
+	}
 	log.Fatal(s.Serve())
 }
@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"log"
+
+	"github.com/mattes/migrate"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+
+	"github.com/caquillo07/graphql-server-demo/conf"
+)
+
+func init() {
+	rootCmd.AddCommand(&cobra.Command{
+		Use:   "migrate",
+		Short: "Apply all pending database migrations",
+		Run:   runMigrateCommand,
+	})
+}
+
+func runMigrateCommand(cmd *cobra.Command, args []string) {
+	config, err := conf.LoadConfig(viper.GetViper())
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if config.Database.URL == "" {
+		log.Fatalln("database.url is not configured")
+	}
+
+	m, err := migrate.New("file://"+config.Database.MigrationsDir, config.Database.URL)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer m.Close()
+
+	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
+		log.Fatalln(err)
+	}
+
+	version, _, _ := m.Version()
+	zap.L().Info("database migrated", zap.Uint("version", version))
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+
+	"github.com/caquillo07/graphql-server-demo/pkg/oidcstub"
+)
+
+func init() {
+	stubCmd := &cobra.Command{
+		Use:   "oidc-stub",
+		Short: "Run a stub OpenID Connect provider that logs everyone in as one user, for development",
+		Args:  cobra.NoArgs,
+		Run:   runOIDCStubCommand,
+	}
+	stubCmd.Flags().String("issuer", "http://localhost:9000", "URL the provider is served at")
+	stubCmd.Flags().String("client-id", "", "the only client accepted, any client when empty")
+	stubCmd.Flags().String("sub", "stub-user", "subject of the user logged in")
+	stubCmd.Flags().String("email", "stub@example.com", "email of the user logged in")
+	stubCmd.Flags().Bool("email-verified", true, "whether the email is verified")
+	stubCmd.Flags().String("name", "Stub User", "name of the user logged in")
+	rootCmd.AddCommand(stubCmd)
+}
+
+func runOIDCStubCommand(cmd *cobra.Command, args []string) {
+	flags := cmd.Flags()
+	issuer, _ := flags.GetString("issuer")
+	clientID, _ := flags.GetString("client-id")
+	user := oidcstub.User{}
+	user.Subject, _ = flags.GetString("sub")
+	user.Email, _ = flags.GetString("email")
+	user.EmailVerified, _ = flags.GetBool("email-verified")
+	user.Name, _ = flags.GetString("name")
+
+	provider, err := oidcstub.New(issuer, clientID, user)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	u, err := url.Parse(issuer)
+	if err != nil || u.Port() == "" {
+		log.Fatalln("issuer must be a URL with a port")
+	}
+
+	zap.L().Info("stub oidc provider listening", zap.String("issuer", issuer))
+	log.Fatal(http.ListenAndServe(":"+u.Port(), provider))
+}
@@ -10,6 +10,7 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/caquillo07/graphql-server-demo/conf"
+	"github.com/caquillo07/graphql-server-demo/pkg/logging"
 )
 
 var cfgFile string
@@ -42,12 +43,14 @@ func init() {
 
 // initConfig reads in config file and ENV variables if set.
 func initLogging() {
-	var logger *zap.Logger
-	if val, _ := rootCmd.PersistentFlags().GetBool("dev-log"); val {
-		logger, _ = zap.NewDevelopment()
+	dev, _ := rootCmd.PersistentFlags().GetBool("dev-log")
+	logger, err := logging.NewLogger(dev)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if dev {
 		logger.Info("Development logging enabled")
-	} else {
-		logger, _ = zap.NewProduction()
 	}
 
 	logger.Info("GraphQL Server Started")
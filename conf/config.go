@@ -3,6 +3,7 @@ package conf
 import (
 	"log"
 	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -12,12 +13,298 @@ type Config struct {
 	Server struct {
 		// Port is the which the server will listen to
 		Port string
+
+		// AdminPort is the port of the listener serving the metrics,
+		// pprof, the config, the log level and the build info, kept apart
+		// so it is not exposed along with the API. Not served when empty.
+		AdminPort string
+
+		// AdminHost is the address the admin listener binds to, loopback
+		// by default as nothing on it is authenticated. Empty binds every
+		// interface.
+		AdminHost string
+
+		// AccessLog logs one line for each request served
+		AccessLog bool
+
+		// ReadTimeout and WriteTimeout are how long reading a request and
+		// writing its response can take, IdleTimeout how long idle
+		// connections are kept open. Websocket connections are not bound
+		// by them.
+		ReadTimeout  time.Duration
+		WriteTimeout time.Duration
+		IdleTimeout  time.Duration
+
+		// MaxHeaderBytes is the largest request header accepted
+		MaxHeaderBytes int
+
+		// MaxBodyBytes is the largest request body accepted
+		MaxBodyBytes int64
+
+		// DrainDelay is how long the server keeps serving requests after
+		// being told to stop, with /readyz failing, so load balancers stop
+		// sending it requests before it stops taking them
+		DrainDelay time.Duration
+
+		// OperationTimeout is how long a GraphQL operation can run, its
+		// database queries are cancelled once it passes. It should be
+		// shorter than WriteTimeout.
+		OperationTimeout time.Duration
+
+		CORS struct {
+			// Enabled answers cross-origin requests from the allowed origins
+			Enabled bool
+
+			// AllowedOrigins are the origins allowed to call the server, "*"
+			// allows any when AllowCredentials is off and an origin can have
+			// one wildcard, e.g. https://*.example.com. Websocket
+			// connections are only accepted from these and the server's own
+			// origin.
+			AllowedOrigins []string
+
+			// AllowedMethods and AllowedHeaders are what cross-origin requests
+			// can use
+			AllowedMethods []string
+			AllowedHeaders []string
+
+			// ExposedHeaders are the response headers browsers let scripts read
+			ExposedHeaders []string
+
+			// AllowCredentials lets browsers send cookies along
+			AllowCredentials bool
+
+			// MaxAge is how long browsers can cache preflight responses
+			MaxAge time.Duration
+		}
+
+		TLS struct {
+			// CertFile and KeyFile are the PEM certificate and key to serve
+			// HTTPS with, plain HTTP is served when empty. They are reloaded
+			// when the files change.
+			CertFile string
+			KeyFile  string
+
+			// ClientCAFile is a PEM bundle of the CAs client certificates are
+			// verified against, services presenting one are authenticated
+			// by its subject
+			ClientCAFile string
+
+			// RequireClientCert rejects connections without a client
+			// certificate instead of treating them as anonymous
+			RequireClientCert bool
+		}
 	}
 
 	GraphQL struct {
 		Playground bool
+
+		// LogQueries logs every operation with its name, document hash,
+		// variables, duration, error count and caller
 		LogQueries bool
+
+		// DebugExtensions adds the Apollo tracing of every operation and the
+		// SQL statements it ran to the response extensions. Admins can ask
+		// for them on a single request with an X-Debug-Extensions header.
+		DebugExtensions bool
+
+		QueryLog struct {
+			// RedactVariables are the variables and input fields whose values
+			// are not logged, any name containing one of them regardless of
+			// case is redacted
+			RedactVariables []string
+
+			// SampleRate is how many operations are logged each second, past
+			// it only one in every SampleThereafter is
+			SampleRate       int
+			SampleThereafter int
+		}
+
+		// IdempotencyTTL is how long the response to a mutation sent with
+		// an Idempotency-Key header is kept to be replayed on retries
+		IdempotencyTTL time.Duration
+
+		RateLimit struct {
+			// Enabled limits how often each client can call the GraphQL
+			// endpoint
+			Enabled bool
+
+			// ChargeComplexity charges each request its query complexity
+			// instead of one token
+			ChargeComplexity bool
+
+			// User, APIKey and Anonymous are the limits of each logged in
+			// user, each API key or client certificate, and each IP sending
+			// unauthenticated requests
+			User      RateLimit
+			APIKey    RateLimit
+			Anonymous RateLimit
+		}
+	}
+
+	Database struct {
+		// URL is the postgres connection string, when empty an in-memory
+		// store is used instead
+		URL string
+
+		// MigrationsDir is the directory holding the SQL migrations
+		MigrationsDir string
+	}
+
+	Auth struct {
+		// Issuer is the expected iss claim of bearer tokens, not checked
+		// when empty
+		Issuer string
+
+		// Audience is the expected aud claim of bearer tokens, not checked
+		// when empty
+		Audience string
+
+		// HMACSecret is the shared secret used to verify HS256 tokens
+		HMACSecret string
+
+		// JWKSFile is a JSON Web Key Set file with the public keys used to
+		// verify RS256 and ES256 tokens
+		JWKSFile string
+
+		// Leeway is the clock skew tolerated when checking exp and nbf
+		Leeway time.Duration
+
+		// SessionTTL is how long the sessions created by logging in last
+		SessionTTL time.Duration
+
+		// ImpersonationTTL is how long the tokens admins get to impersonate
+		// a user last
+		ImpersonationTTL time.Duration
+
+		SessionCookie struct {
+			// Enabled sets the session token in an HttpOnly cookie on login
+			Enabled bool
+
+			// Name is the name of the cookie
+			Name string
+
+			// Domain is the domain of the cookie, the request host when empty
+			Domain string
+
+			// Secure only sends the cookie over HTTPS
+			Secure bool
+		}
+
+		Lockout struct {
+			// MaxAccountFailures is the number of failed logins to an account
+			// within the window that locks it out, 0 disables the lockout
+			MaxAccountFailures int
+
+			// MaxIPFailures is the number of failed logins from an IP within
+			// the window that locks it out, 0 disables the lockout
+			MaxIPFailures int
+
+			// Window is how long failed logins are remembered for
+			Window time.Duration
+
+			// Duration is how long a lockout lasts
+			Duration time.Duration
+
+			// BaseDelay is how long a login is delayed after a failure, it
+			// doubles with every further failure up to MaxDelay
+			BaseDelay time.Duration
+			MaxDelay  time.Duration
+		}
+
+		TOTP struct {
+			// Issuer is the name authenticator apps show the accounts under
+			Issuer string
+		}
+
+		// EmailVerificationTTL is how long email verification links last
+		EmailVerificationTTL time.Duration
+
+		// PasswordResetTTL is how long password reset links last
+		PasswordResetTTL time.Duration
+
+		OIDC struct {
+			// Issuer is the URL of the OpenID Connect provider, the login
+			// routes are only served when it is set
+			Issuer string
+
+			// ClientID and ClientSecret are the credentials of the server
+			// at the provider
+			ClientID     string
+			ClientSecret string
+
+			// RedirectURL is the URL of the callback route registered at
+			// the provider, e.g. https://example.com/auth/oidc/callback
+			RedirectURL string
+
+			// Scopes are the scopes requested along with openid
+			Scopes []string
+
+			// PostLoginURL is where users are sent after logging in, with
+			// the session in its cookie, which must be enabled. When empty
+			// the callback responds with the session token instead. Users
+			// with TOTP enabled get a totpChallenge for loginTotp instead
+			// of a session, in the query or the response.
+			PostLoginURL string
+
+			// LinkByEmail logs users in to the existing account with the
+			// email the provider verified, linking it. Off, such a login
+			// fails with EMAIL_TAKEN. Only turn it on for providers trusted
+			// to verify emails, anyone with an address verified there can
+			// take over the account having it.
+			LinkByEmail bool
+		}
+	}
+
+	Mail struct {
+		// Driver is smtp to send emails, or log to only write them out for
+		// local development. When empty no emails are sent, and email
+		// verification and password resets are disabled.
+		Driver string
+
+		// From is the sender of the emails
+		From string
+
+		// LinkBaseURL is the URL of the frontend the links in emails open,
+		// e.g. https://example.com/verify-email?token=...
+		LinkBaseURL string
+
+		// LogFile is the file the log driver appends emails to, they are
+		// logged when empty
+		LogFile string
+
+		SMTP struct {
+			Host     string
+			Port     string
+			Username string
+			Password string
+		}
 	}
+
+	Tracing struct {
+		// Exporter is otlp to send spans to an OpenTelemetry collector, or
+		// stdout to write them out for local development. Tracing is off
+		// when empty.
+		Exporter string
+
+		// OTLPURL is the traces endpoint of the collector
+		OTLPURL string
+
+		// ServiceName is the name spans are reported under
+		ServiceName string
+
+		// SampleRatio is the share of new traces recorded, from 0 to 1.
+		// Traces continued from a caller are recorded when it did.
+		SampleRatio float64
+	}
+}
+
+// RateLimit is the token bucket a client gets.
+type RateLimit struct {
+	// Rate is the tokens added every second, 0 leaves the class unlimited
+	Rate float64
+
+	// Burst is the most tokens a client can spend at once
+	Burst int
 }
 
 // LoadConfig loads configuration from the viper instance.
@@ -39,7 +326,56 @@ func InitViper(configFile string) {
 	viper.SetConfigFile(configFile)
 
 	// Default settings
-	viper.SetDefault("server.allowCORS", true)
+	viper.SetDefault("server.adminHost", "127.0.0.1")
+	viper.SetDefault("server.accessLog", true)
+	viper.SetDefault("server.readTimeout", "15s")
+	viper.SetDefault("server.writeTimeout", "30s")
+	viper.SetDefault("server.idleTimeout", "2m")
+	viper.SetDefault("server.maxHeaderBytes", 1<<20)
+	viper.SetDefault("server.maxBodyBytes", 1<<20)
+	viper.SetDefault("server.operationTimeout", "10s")
+	viper.SetDefault("server.drainDelay", "5s")
+	viper.SetDefault("server.cors.enabled", true)
+	viper.SetDefault("server.cors.allowedOrigins", []string{"http://localhost:*"})
+	viper.SetDefault("server.cors.allowedMethods", []string{"GET", "POST"})
+	viper.SetDefault("server.cors.allowedHeaders", []string{
+		"Authorization", "Content-Type", "Idempotency-Key", "X-Debug-Extensions",
+	})
+	viper.SetDefault("server.cors.exposedHeaders", []string{
+		"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After", "Idempotent-Replayed",
+	})
+	viper.SetDefault("server.cors.allowCredentials", true)
+	viper.SetDefault("server.cors.maxAge", "10m")
+	viper.SetDefault("graphql.queryLog.redactVariables", []string{"password", "token", "secret", "code"})
+	viper.SetDefault("graphql.queryLog.sampleRate", 100)
+	viper.SetDefault("graphql.queryLog.sampleThereafter", 100)
+	viper.SetDefault("graphql.idempotencyTTL", "24h")
+	viper.SetDefault("graphql.rateLimit.enabled", true)
+	viper.SetDefault("graphql.rateLimit.user.rate", 10)
+	viper.SetDefault("graphql.rateLimit.user.burst", 50)
+	viper.SetDefault("graphql.rateLimit.apiKey.rate", 50)
+	viper.SetDefault("graphql.rateLimit.apiKey.burst", 200)
+	viper.SetDefault("graphql.rateLimit.anonymous.rate", 2)
+	viper.SetDefault("graphql.rateLimit.anonymous.burst", 20)
+	viper.SetDefault("database.migrationsDir", "migrations")
+	viper.SetDefault("auth.leeway", "30s")
+	viper.SetDefault("auth.sessionTTL", "720h")
+	viper.SetDefault("auth.impersonationTTL", "15m")
+	viper.SetDefault("auth.sessionCookie.name", "session")
+	viper.SetDefault("auth.lockout.maxAccountFailures", 5)
+	viper.SetDefault("auth.lockout.maxIPFailures", 50)
+	viper.SetDefault("auth.lockout.window", "15m")
+	viper.SetDefault("auth.lockout.duration", "15m")
+	viper.SetDefault("auth.lockout.baseDelay", "250ms")
+	viper.SetDefault("auth.lockout.maxDelay", "5s")
+	viper.SetDefault("auth.totp.issuer", "graphql-server-demo")
+	viper.SetDefault("auth.emailVerificationTTL", "24h")
+	viper.SetDefault("auth.passwordResetTTL", "1h")
+	viper.SetDefault("auth.oidc.scopes", []string{"email", "profile"})
+	viper.SetDefault("mail.smtp.port", "587")
+	viper.SetDefault("tracing.otlpURL", "http://localhost:4318/v1/traces")
+	viper.SetDefault("tracing.serviceName", "graphql-server-demo")
+	viper.SetDefault("tracing.sampleRatio", 1)
 	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 	if err := viper.ReadInConfig(); err != nil {
 		log.Fatal(err)
@@ -4,10 +4,12 @@ go 1.13
 
 require (
 	github.com/99designs/gqlgen v0.10.2
+	github.com/fsnotify/fsnotify v1.4.7
 	github.com/go-chi/chi v4.0.2+incompatible
 	github.com/go-chi/render v1.0.1
 	github.com/gofrs/uuid v3.2.0+incompatible
 	github.com/golang-migrate/migrate/v4 v4.3.1
+	github.com/gorilla/websocket v1.4.0
 	github.com/jinzhu/gorm v1.9.8
 	github.com/lib/pq v1.3.0
 	github.com/mattes/migrate v3.0.1+incompatible
@@ -16,4 +18,5 @@ require (
 	github.com/spf13/viper v1.4.0
 	github.com/vektah/gqlparser v1.2.0
 	go.uber.org/zap v1.10.0
+	golang.org/x/crypto v0.0.0-20190426145343-a29dc8fdc734
 )
@@ -0,0 +1,15 @@
+ALTER TABLE sessions
+    ADD COLUMN impersonated_by TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS audit_records (
+    id              UUID PRIMARY KEY,
+    actor           TEXT        NOT NULL,
+    impersonated_by TEXT        NOT NULL DEFAULT '',
+    action          TEXT        NOT NULL,
+    details         TEXT        NOT NULL DEFAULT '',
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX audit_records_actor_idx ON audit_records (actor, created_at);
+CREATE INDEX audit_records_impersonated_by_idx ON audit_records (impersonated_by, created_at)
+    WHERE impersonated_by <> '';
@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS users_search_vector_update ON users;
+DROP INDEX IF EXISTS users_search_vector_idx;
+ALTER TABLE users DROP COLUMN IF EXISTS search_vector;
@@ -0,0 +1,11 @@
+ALTER TABLE users ADD COLUMN search_vector TSVECTOR;
+
+UPDATE users SET search_vector = to_tsvector('pg_catalog.simple', name);
+
+CREATE INDEX users_search_vector_idx ON users USING GIN (search_vector);
+
+-- keep the search vector in sync with the searchable columns
+CREATE TRIGGER users_search_vector_update
+    BEFORE INSERT OR UPDATE ON users
+    FOR EACH ROW EXECUTE PROCEDURE
+    tsvector_update_trigger(search_vector, 'pg_catalog.simple', name);
@@ -0,0 +1,4 @@
+ALTER TABLE users ADD COLUMN email TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ALTER COLUMN email DROP DEFAULT;
+
+CREATE UNIQUE INDEX users_email_idx ON users (lower(email)) WHERE email <> '';
@@ -0,0 +1,14 @@
+ALTER TABLE users
+    ADD COLUMN password_hash TEXT   NOT NULL DEFAULT '',
+    ADD COLUMN roles         TEXT[] NOT NULL DEFAULT '{USER}';
+
+CREATE TABLE IF NOT EXISTS sessions (
+    id         UUID PRIMARY KEY,
+    user_id    UUID        NOT NULL REFERENCES users (id),
+    token_hash TEXT        NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX sessions_user_id_idx ON sessions (user_id);
@@ -0,0 +1,5 @@
+ALTER TABLE users
+    ADD COLUMN totp_secret    TEXT    NOT NULL DEFAULT '',
+    ADD COLUMN totp_enabled   BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN totp_last_step BIGINT  NOT NULL DEFAULT 0,
+    ADD COLUMN recovery_codes TEXT[]  NOT NULL DEFAULT '{}';
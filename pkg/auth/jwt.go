@@ -0,0 +1,240 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// ErrInvalidToken is returned for tokens that are malformed, not signed
+// by a trusted key or whose claims are not valid.
+var ErrInvalidToken = errors.New("invalid token")
+
+// Claims are the claims of a verified token.
+type Claims struct {
+	Subject   string
+	Issuer    string
+	Audience  []string
+	ExpiresAt time.Time
+	NotBefore time.Time
+	IssuedAt  time.Time
+
+	// Roles the roles granted to the subject by the "roles" claim
+	Roles []string
+}
+
+// Principal returns the principal authenticated by the claims.
+func (c *Claims) Principal() *Principal {
+	return &Principal{Type: PrincipalUser, Subject: c.Subject, Roles: c.Roles}
+}
+
+// JWTVerifier verifies JSON Web Tokens signed with HS256 using a shared
+// secret, or with RS256 and ES256 using the keys of a KeySet.
+type JWTVerifier struct {
+	// Issuer the expected iss claim, not checked when empty
+	Issuer string
+
+	// Audience the expected aud claim, not checked when empty
+	Audience string
+
+	// Secret the shared secret of HS256 tokens, HS256 is rejected when empty
+	Secret []byte
+
+	// Keys the public keys of RS256 and ES256 tokens
+	Keys KeySet
+
+	// Leeway the clock skew tolerated when checking exp and nbf
+	Leeway time.Duration
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type jwtClaims struct {
+	Subject   string          `json:"sub"`
+	Issuer    string          `json:"iss"`
+	Audience  json.RawMessage `json:"aud"`
+	ExpiresAt *json.Number    `json:"exp"`
+	NotBefore *json.Number    `json:"nbf"`
+	IssuedAt  *json.Number    `json:"iat"`
+	Roles     []string        `json:"roles"`
+}
+
+// Verify checks the signature of the token and validates its claims. The
+// exp claim is required.
+func (v *JWTVerifier) Verify(token string) (*Claims, error) {
+	return v.VerifyWithClaims(token, nil)
+}
+
+// VerifyWithClaims verifies the token like Verify, also decoding its
+// claims into extra when it is not nil, for the claims Claims lacks.
+func (v *JWTVerifier) VerifyWithClaims(token string, extra interface{}) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, ErrInvalidToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	if !v.verifySignature(header, parts[0]+"."+parts[1], signature) {
+		return nil, ErrInvalidToken
+	}
+
+	var raw jwtClaims
+	if err := decodeSegment(parts[1], &raw); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if extra != nil {
+		if err := decodeSegment(parts[1], extra); err != nil {
+			return nil, ErrInvalidToken
+		}
+	}
+	return v.validateClaims(raw, time.Now())
+}
+
+func (v *JWTVerifier) verifySignature(header jwtHeader, signed string, signature []byte) bool {
+	switch header.Alg {
+	case "HS256":
+		if len(v.Secret) == 0 {
+			return false
+		}
+		mac := hmac.New(sha256.New, v.Secret)
+		mac.Write([]byte(signed))
+		return hmac.Equal(mac.Sum(nil), signature)
+	case "RS256":
+		key, ok := v.key(header.Kid).(*rsa.PublicKey)
+		if !ok {
+			return false
+		}
+		digest := sha256.Sum256([]byte(signed))
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil
+	case "ES256":
+		key, ok := v.key(header.Kid).(*ecdsa.PublicKey)
+		if !ok || key.Curve.Params().Name != "P-256" || len(signature) != 64 {
+			return false
+		}
+		digest := sha256.Sum256([]byte(signed))
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(key, digest[:], r, s)
+	default:
+		// anything else, "none" included, is never trusted
+		return false
+	}
+}
+
+// key returns the key with the given ID. Tokens without a key ID are only
+// accepted when there is a single key to choose from.
+func (v *JWTVerifier) key(kid string) crypto.PublicKey {
+	if kid == "" && len(v.Keys) == 1 {
+		for _, key := range v.Keys {
+			return key
+		}
+	}
+	return v.Keys[kid]
+}
+
+func (v *JWTVerifier) validateClaims(raw jwtClaims, now time.Time) (*Claims, error) {
+	claims := &Claims{
+		Subject: raw.Subject,
+		Issuer:  raw.Issuer,
+		Roles:   raw.Roles,
+	}
+
+	var err error
+	if claims.ExpiresAt, err = numericDate(raw.ExpiresAt); err != nil || claims.ExpiresAt.IsZero() {
+		return nil, ErrInvalidToken
+	}
+	if claims.NotBefore, err = numericDate(raw.NotBefore); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if claims.IssuedAt, err = numericDate(raw.IssuedAt); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if claims.Audience, err = audience(raw.Audience); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if !now.Before(claims.ExpiresAt.Add(v.Leeway)) {
+		return nil, ErrInvalidToken
+	}
+	if !claims.NotBefore.IsZero() && now.Add(v.Leeway).Before(claims.NotBefore) {
+		return nil, ErrInvalidToken
+	}
+	if v.Issuer != "" && claims.Issuer != v.Issuer {
+		return nil, ErrInvalidToken
+	}
+	if v.Audience != "" && !contains(claims.Audience, v.Audience) {
+		return nil, ErrInvalidToken
+	}
+	if claims.Subject == "" {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// numericDate converts a JWT NumericDate, the seconds since the epoch, to
+// a time. Missing dates are the zero time.
+func numericDate(n *json.Number) (time.Time, error) {
+	if n == nil {
+		return time.Time{}, nil
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, int64(f*float64(time.Second))), nil
+}
+
+// audience parses the aud claim, which is either a string or an array of
+// strings.
+func audience(raw json.RawMessage) ([]string, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	var single string
+	if err := json.Unmarshal(raw, &single); err == nil {
+		return []string{single}, nil
+	}
+	var many []string
+	if err := json.Unmarshal(raw, &many); err != nil {
+		return nil, err
+	}
+	return many, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,211 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+var testSecret = []byte("secret")
+
+// signHS256 returns a token with the header and claims signed with the
+// secret.
+func signHS256(t *testing.T, header, claims map[string]interface{}, secret []byte) string {
+	signed := encodeSegment(t, header) + "." + encodeSegment(t, claims)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func signES256(t *testing.T, header, claims map[string]interface{}, key *ecdsa.PrivateKey) string {
+	signed := encodeSegment(t, header) + "." + encodeSegment(t, claims)
+	digest := sha256.Sum256([]byte(signed))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	// r and s are padded to 32 bytes each
+	signature := make([]byte, 64)
+	rb, sb := r.Bytes(), s.Bytes()
+	copy(signature[32-len(rb):32], rb)
+	copy(signature[64-len(sb):], sb)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func encodeSegment(t *testing.T, v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func TestJWTVerifierVerify(t *testing.T) {
+	esKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier := &JWTVerifier{
+		Issuer:   "issuer",
+		Audience: "api",
+		Secret:   testSecret,
+		Keys:     KeySet{"es": crypto.PublicKey(&esKey.PublicKey)},
+		Leeway:   time.Minute,
+	}
+
+	now := time.Now().Unix()
+	hs256 := map[string]interface{}{"alg": "HS256"}
+	es256 := map[string]interface{}{"alg": "ES256", "kid": "es"}
+
+	tests := []struct {
+		name   string
+		header map[string]interface{}
+		claims map[string]interface{}
+		valid  bool
+	}{
+		{
+			"hs256", hs256,
+			map[string]interface{}{"sub": "user", "iss": "issuer", "aud": "api", "exp": now + 3600},
+			true,
+		},
+		{
+			"es256", es256,
+			map[string]interface{}{"sub": "user", "iss": "issuer", "aud": "api", "exp": now + 3600},
+			true,
+		},
+		{
+			"es256 single key without kid", map[string]interface{}{"alg": "ES256"},
+			map[string]interface{}{"sub": "user", "iss": "issuer", "aud": "api", "exp": now + 3600},
+			true,
+		},
+		{
+			"audience list", hs256,
+			map[string]interface{}{"sub": "user", "iss": "issuer", "aud": []string{"other", "api"}, "exp": now + 3600},
+			true,
+		},
+		{
+			"expired within leeway", hs256,
+			map[string]interface{}{"sub": "user", "iss": "issuer", "aud": "api", "exp": now - 30},
+			true,
+		},
+		{
+			"expired", hs256,
+			map[string]interface{}{"sub": "user", "iss": "issuer", "aud": "api", "exp": now - 120},
+			false,
+		},
+		{
+			"no exp", hs256,
+			map[string]interface{}{"sub": "user", "iss": "issuer", "aud": "api"},
+			false,
+		},
+		{
+			"not yet valid", hs256,
+			map[string]interface{}{"sub": "user", "iss": "issuer", "aud": "api", "exp": now + 3600, "nbf": now + 120},
+			false,
+		},
+		{
+			"wrong issuer", hs256,
+			map[string]interface{}{"sub": "user", "iss": "other", "aud": "api", "exp": now + 3600},
+			false,
+		},
+		{
+			"wrong audience", hs256,
+			map[string]interface{}{"sub": "user", "iss": "issuer", "aud": []string{"other"}, "exp": now + 3600},
+			false,
+		},
+		{
+			"no subject", hs256,
+			map[string]interface{}{"iss": "issuer", "aud": "api", "exp": now + 3600},
+			false,
+		},
+		{
+			"unknown kid", map[string]interface{}{"alg": "ES256", "kid": "other"},
+			map[string]interface{}{"sub": "user", "iss": "issuer", "aud": "api", "exp": now + 3600},
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var token string
+			if tt.header["alg"] == "ES256" {
+				token = signES256(t, tt.header, tt.claims, esKey)
+			} else {
+				token = signHS256(t, tt.header, tt.claims, testSecret)
+			}
+
+			claims, err := verifier.Verify(token)
+			if !tt.valid {
+				if err != ErrInvalidToken {
+					t.Fatalf("Verify() error = %v, want ErrInvalidToken", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if claims.Subject != "user" {
+				t.Errorf("Verify() subject = %q, want user", claims.Subject)
+			}
+		})
+	}
+}
+
+// TestJWTVerifierRejectsForgedTokens covers tokens an attacker can make
+// without the secret or the private key.
+func TestJWTVerifierRejectsForgedTokens(t *testing.T) {
+	esKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier := &JWTVerifier{
+		Secret: testSecret,
+		Keys:   KeySet{"es": crypto.PublicKey(&esKey.PublicKey)},
+	}
+	claims := map[string]interface{}{"sub": "user", "exp": time.Now().Add(time.Hour).Unix()}
+	publicKey := elliptic.Marshal(elliptic.P256(), esKey.X, esKey.Y)
+
+	for name, token := range map[string]string{
+		"wrong secret":          signHS256(t, map[string]interface{}{"alg": "HS256"}, claims, []byte("other")),
+		"alg none":              encodeSegment(t, map[string]interface{}{"alg": "none"}) + "." + encodeSegment(t, claims) + ".",
+		"hs256 with public key": signHS256(t, map[string]interface{}{"alg": "HS256", "kid": "es"}, claims, publicKey),
+		"malformed":             "not.a.token",
+		"two segments":          "a.b",
+	} {
+		if _, err := verifier.Verify(token); err != ErrInvalidToken {
+			t.Errorf("%s: Verify() error = %v, want ErrInvalidToken", name, err)
+		}
+	}
+
+	// without a secret HS256 is not accepted at all, not even signed with
+	// an empty key
+	disabled := &JWTVerifier{}
+	token := signHS256(t, map[string]interface{}{"alg": "HS256"}, claims, nil)
+	if _, err := disabled.Verify(token); err != ErrInvalidToken {
+		t.Errorf("Verify() without a secret error = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestJWTVerifierRoles(t *testing.T) {
+	verifier := &JWTVerifier{Secret: testSecret}
+	token := signHS256(t, map[string]interface{}{"alg": "HS256"}, map[string]interface{}{
+		"sub":   "user",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"roles": []string{"ADMIN", "USER"},
+	}, testSecret)
+
+	claims, err := verifier.Verify(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	principal := claims.Principal()
+	if principal.Subject != "user" || !principal.HasRole("ADMIN") || principal.HasRole("OTHER") {
+		t.Errorf("Principal() = %+v, want user with the ADMIN and USER roles", principal)
+	}
+}
@@ -0,0 +1,305 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// oidcKeysRefreshInterval is the least time between two fetches of the
+// provider's JWKS, which is fetched again when a token is signed with an
+// unknown key
+const oidcKeysRefreshInterval = time.Minute
+
+// OIDCProvider runs the OpenID Connect authorization code flow, with PKCE,
+// against an identity provider found through its discovery document.
+type OIDCProvider struct {
+	// Issuer the issuer URL of the provider, its discovery document is
+	// read from Issuer + "/.well-known/openid-configuration"
+	Issuer string
+
+	// ClientID and ClientSecret the credentials of this application at the
+	// provider, the secret is not sent when empty
+	ClientID     string
+	ClientSecret string
+
+	// RedirectURL the callback URL the provider sends the user back to
+	RedirectURL string
+
+	// Scopes the scopes requested, openid is always included
+	Scopes []string
+
+	// Leeway the clock skew tolerated when checking the ID token dates
+	Leeway time.Duration
+
+	// Client the HTTP client used to reach the provider, http.DefaultClient
+	// when nil
+	Client *http.Client
+
+	mu            sync.Mutex
+	discovery     *oidcDiscovery
+	keys          KeySet
+	keysFetchedAt time.Time
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// IDToken is a verified OpenID Connect ID token.
+type IDToken struct {
+	Claims
+
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+type idTokenClaims struct {
+	Nonce         string `json:"nonce"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+}
+
+// AuthCodeURL returns the URL of the provider the user is sent to to log
+// in.
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	scopes := []string{"openid"}
+	for _, scope := range p.Scopes {
+		if scope != "openid" {
+			scopes = append(scopes, scope)
+		}
+	}
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", p.ClientID)
+	params.Set("redirect_uri", p.RedirectURL)
+	params.Set("scope", strings.Join(scopes, " "))
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+	params.Set("code_challenge", codeChallenge)
+	params.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return discovery.AuthorizationEndpoint + sep + params.Encode(), nil
+}
+
+// Exchange trades the authorization code for the tokens of the user, and
+// returns the verified ID token.
+func (p *OIDCProvider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*IDToken, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.RedirectURL)
+	form.Set("client_id", p.ClientID)
+	form.Set("code_verifier", codeVerifier)
+	if p.ClientSecret != "" {
+		form.Set("client_secret", p.ClientSecret)
+	}
+	req, err := http.NewRequest(http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var tokens struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	status, err := p.do(req.WithContext(ctx), &tokens)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("token request failed with status %d: %s %s", status, tokens.Error, tokens.ErrorDescription)
+	}
+	if tokens.IDToken == "" {
+		return nil, errors.New("token response has no id_token")
+	}
+	return p.VerifyIDToken(ctx, tokens.IDToken, nonce)
+}
+
+// VerifyIDToken checks the signature of the ID token against the keys of
+// the provider, and validates that it was issued by the provider for this
+// client with the nonce.
+func (p *OIDCProvider) VerifyIDToken(ctx context.Context, token, nonce string) (*IDToken, error) {
+	keys, err := p.keySet(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var extra idTokenClaims
+	verifier := &JWTVerifier{Issuer: p.Issuer, Audience: p.ClientID, Keys: keys, Leeway: p.Leeway}
+	claims, err := verifier.VerifyWithClaims(token, &extra)
+	if err == ErrInvalidToken {
+		// the provider may have rotated its keys since they were fetched
+		if keys, err = p.keySet(ctx, true); err != nil {
+			return nil, err
+		}
+		verifier.Keys = keys
+		claims, err = verifier.VerifyWithClaims(token, &extra)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(extra.Nonce), []byte(nonce)) != 1 {
+		return nil, ErrInvalidToken
+	}
+
+	return &IDToken{
+		Claims:        *claims,
+		Email:         extra.Email,
+		EmailVerified: extra.EmailVerified,
+		Name:          extra.Name,
+	}, nil
+}
+
+// discover returns the discovery document of the provider, fetching it the
+// first time.
+func (p *OIDCProvider) discover(ctx context.Context) (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(p.Issuer, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	var discovery oidcDiscovery
+	status, err := p.do(req.WithContext(ctx), &discovery)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("openid configuration request failed with status %d", status)
+	}
+
+	// the issuer must match exactly, or tokens of another issuer could be
+	// accepted, see OpenID Connect Discovery section 4.3
+	if discovery.Issuer != p.Issuer {
+		return nil, fmt.Errorf("openid configuration issuer %q does not match %q", discovery.Issuer, p.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, errors.New("openid configuration is missing endpoints")
+	}
+	p.discovery = &discovery
+	return p.discovery, nil
+}
+
+// keySet returns the signing keys of the provider, fetching them when they
+// were not yet, or when refresh is set and they were not just fetched.
+func (p *OIDCProvider) keySet(ctx context.Context, refresh bool) (KeySet, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.keys != nil && (!refresh || time.Since(p.keysFetchedAt) < oidcKeysRefreshInterval) {
+		return p.keys, nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, discovery.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.client().Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("jwks request failed with status %d", resp.StatusCode)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := ParseJWKS(b)
+	if err != nil {
+		return nil, err
+	}
+	p.keys = keys
+	p.keysFetchedAt = time.Now()
+	return keys, nil
+}
+
+// do sends the request and decodes the JSON response into v, returning
+// the status code.
+func (p *OIDCProvider) do(req *http.Request, v interface{}) (int, error) {
+	resp, err := p.client().Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil && resp.StatusCode == http.StatusOK {
+		return 0, err
+	}
+	return resp.StatusCode, nil
+}
+
+func (p *OIDCProvider) client() *http.Client {
+	if p.Client != nil {
+		return p.Client
+	}
+	return http.DefaultClient
+}
+
+// NewPKCEVerifier returns a new PKCE code verifier and its S256 challenge,
+// as described in RFC 7636.
+func NewPKCEVerifier() (verifier, challenge string, err error) {
+	verifier, err = RandomToken()
+	if err != nil {
+		return "", "", err
+	}
+	return verifier, PKCEChallenge(verifier), nil
+}
+
+// PKCEChallenge returns the S256 code challenge of the verifier.
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// RandomToken returns 32 random bytes encoded as URL safe base64, for
+// values such as the OAuth state and nonce.
+func RandomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
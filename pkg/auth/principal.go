@@ -0,0 +1,74 @@
+// Package auth holds the authenticated caller of a request and the ways
+// it can be authenticated.
+package auth
+
+import "context"
+
+// Roles a principal can have.
+const (
+	RoleAdmin = "ADMIN"
+	RoleUser  = "USER"
+)
+
+// PrincipalType tells how a principal was authenticated.
+type PrincipalType string
+
+// Types of principals.
+const (
+	// PrincipalUser is authenticated by a bearer token
+	PrincipalUser PrincipalType = "user"
+
+	// PrincipalAPIKey is a service authenticated by an API key
+	PrincipalAPIKey PrincipalType = "apikey"
+
+	// PrincipalClientCert is a service authenticated by a TLS client
+	// certificate, its subject being the certificate's subject
+	PrincipalClientCert PrincipalType = "clientcert"
+)
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	// Type how the caller was authenticated
+	Type PrincipalType
+
+	// Subject identifies the caller, for users it is their user ID and for
+	// API keys the ID of the key
+	Subject string
+
+	// Roles the roles granted to the caller
+	Roles []string
+
+	// SessionID the ID of the session the user logged in with, empty when
+	// authenticated some other way
+	SessionID string
+
+	// ImpersonatedBy the subject of the admin acting as the user, the
+	// principal otherwise being the user's. Empty when not impersonated.
+	ImpersonatedBy string
+}
+
+// HasRole reports whether the principal has any of the roles.
+func (p *Principal) HasRole(roles ...string) bool {
+	for _, have := range p.Roles {
+		for _, want := range roles {
+			if have == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of the context carrying the principal.
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext returns the principal of the request, if the
+// request was authenticated.
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok && p != nil
+}
@@ -0,0 +1,200 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// LoginThrottle tracks the failed logins per account and per source IP.
+// Each failure past the first delays the next attempt a bit more, and too
+// many failures within the window lock the account or IP out for a while.
+//
+// Attempts are reserved by Check and count as failures until they end with
+// Failure, Success or Release, so attempts made in parallel cannot all get
+// through before the first of them fails.
+type LoginThrottle struct {
+	// MaxAccountFailures failures of an account that lock it out
+	MaxAccountFailures int
+
+	// MaxIPFailures failures from an IP that lock it out, it is higher than
+	// for accounts since many users can share an IP
+	MaxIPFailures int
+
+	// Window how long failures are remembered for
+	Window time.Duration
+
+	// LockoutDuration how long a lockout lasts
+	LockoutDuration time.Duration
+
+	// BaseDelay the delay after the second failure, doubled after each
+	// failure up to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+
+	mu       sync.Mutex
+	accounts map[string]*loginFailures
+	ips      map[string]*loginFailures
+}
+
+type loginFailures struct {
+	count       int
+	last        time.Time
+	lockedUntil time.Time
+
+	// pending attempts reserved by Check that have not ended yet
+	pending int
+}
+
+// Check reserves a login attempt, returning how long it should be delayed
+// and whether the account or IP is locked out. Attempts that are not
+// locked out must be ended with Failure, Success or Release.
+func (t *LoginThrottle) Check(account, ip string, now time.Time) (delay time.Duration, locked bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.accounts == nil {
+		t.accounts = map[string]*loginFailures{}
+		t.ips = map[string]*loginFailures{}
+	}
+	a := t.current(t.accounts, account, now)
+	i := t.current(t.ips, ip, now)
+	if now.Before(a.lockedUntil) || now.Before(i.lockedUntil) {
+		return 0, true
+	}
+
+	// the pending attempts could all fail, they count towards the lockout
+	// before they do
+	accountFailures := a.count + a.pending
+	ipFailures := i.count + i.pending
+	if (t.MaxAccountFailures > 0 && accountFailures >= t.MaxAccountFailures) ||
+		(t.MaxIPFailures > 0 && ipFailures >= t.MaxIPFailures) {
+		return 0, true
+	}
+
+	a.pending++
+	i.pending++
+	t.accounts[account] = a
+	t.ips[ip] = i
+
+	failures := accountFailures
+	if ipFailures > failures {
+		failures = ipFailures
+	}
+	return t.delay(failures), false
+}
+
+// Failure ends an attempt that failed, it reports whether the failure
+// locked the account or IP out.
+func (t *LoginThrottle) Failure(account, ip string, now time.Time) (accountLocked, ipLocked bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.accounts == nil {
+		t.accounts = map[string]*loginFailures{}
+		t.ips = map[string]*loginFailures{}
+	}
+	release(t.accounts, account)
+	release(t.ips, ip)
+	accountLocked = t.fail(t.accounts, account, t.MaxAccountFailures, now)
+	ipLocked = t.fail(t.ips, ip, t.MaxIPFailures, now)
+	return accountLocked, ipLocked
+}
+
+// Success ends an attempt that succeeded, forgetting the failures of the
+// account. The failures of the IP are kept, so an attacker cannot reset
+// them by logging in to an account of their own.
+func (t *LoginThrottle) Success(account, ip string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	release(t.accounts, account)
+	release(t.ips, ip)
+	if f, ok := t.accounts[account]; ok {
+		if f.pending > 0 {
+			// other attempts on the account are still going
+			t.accounts[account] = &loginFailures{pending: f.pending}
+		} else {
+			delete(t.accounts, account)
+		}
+	}
+}
+
+// Release ends an attempt that neither failed nor succeeded, such as one
+// that needs a second factor or could not be checked.
+func (t *LoginThrottle) Release(account, ip string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	release(t.accounts, account)
+	release(t.ips, ip)
+}
+
+func release(failures map[string]*loginFailures, key string) {
+	if f, ok := failures[key]; ok && f.pending > 0 {
+		f.pending--
+	}
+}
+
+// Unlock clears the lockout and the failures of the account.
+func (t *LoginThrottle) Unlock(account string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.accounts, account)
+}
+
+// Prune forgets the failures and lockouts that are over.
+func (t *LoginThrottle) Prune(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, failures := range []map[string]*loginFailures{t.accounts, t.ips} {
+		for key, f := range failures {
+			if t.expired(f, now) {
+				delete(failures, key)
+			}
+		}
+	}
+}
+
+func (t *LoginThrottle) fail(failures map[string]*loginFailures, key string, max int, now time.Time) bool {
+	f := t.current(failures, key, now)
+	f.count++
+	f.last = now
+	failures[key] = f
+
+	if max > 0 && f.count >= max && !now.Before(f.lockedUntil) {
+		f.lockedUntil = now.Add(t.LockoutDuration)
+		f.count = 0
+		return true
+	}
+	return false
+}
+
+// current returns the failures of the key, starting over when the last
+// one is out of the window.
+func (t *LoginThrottle) current(failures map[string]*loginFailures, key string, now time.Time) *loginFailures {
+	f, ok := failures[key]
+	if !ok || t.expired(f, now) {
+		return &loginFailures{}
+	}
+	if now.Sub(f.last) > t.Window {
+		f.count = 0
+	}
+	return f
+}
+
+func (t *LoginThrottle) expired(f *loginFailures, now time.Time) bool {
+	return f.pending == 0 && now.Sub(f.last) > t.Window && !now.Before(f.lockedUntil)
+}
+
+func (t *LoginThrottle) delay(failures int) time.Duration {
+	if failures < 1 || t.BaseDelay <= 0 {
+		return 0
+	}
+	delay := t.BaseDelay
+	for i := 1; i < failures && delay < t.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > t.MaxDelay {
+		delay = t.MaxDelay
+	}
+	return delay
+}
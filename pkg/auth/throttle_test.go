@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestThrottle() *LoginThrottle {
+	return &LoginThrottle{
+		MaxAccountFailures: 3,
+		MaxIPFailures:      5,
+		Window:             time.Minute,
+		LockoutDuration:    time.Hour,
+	}
+}
+
+func TestLoginThrottleLockout(t *testing.T) {
+	now := time.Unix(1000, 0)
+
+	tests := []struct {
+		name string
+		// failed attempts are made from the IPs in order, against the same
+		// account or a different one each time
+		ips         []string
+		sameAccount bool
+		wantLocked  bool
+	}{
+		{"under the account limit", []string{"ip1", "ip2"}, true, false},
+		{"account limit", []string{"ip1", "ip2", "ip3"}, true, true},
+		{"under the ip limit", []string{"ip1", "ip1", "ip1", "ip1"}, false, false},
+		{"ip limit", []string{"ip1", "ip1", "ip1", "ip1", "ip1"}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			throttle := newTestThrottle()
+			account := func(i int) string {
+				if tt.sameAccount {
+					return "user"
+				}
+				return "user" + string(rune('a'+i))
+			}
+			for i, ip := range tt.ips {
+				if _, locked := throttle.Check(account(i), ip, now); locked {
+					t.Fatalf("attempt %d locked out", i)
+				}
+				throttle.Failure(account(i), ip, now)
+			}
+			if _, locked := throttle.Check(account(len(tt.ips)), tt.ips[0], now); locked != tt.wantLocked {
+				t.Errorf("Check() locked = %v, want %v", locked, tt.wantLocked)
+			}
+		})
+	}
+}
+
+func TestLoginThrottleReservesParallelAttempts(t *testing.T) {
+	throttle := newTestThrottle()
+	now := time.Unix(1000, 0)
+
+	// attempts checked before any of them fails count towards the limit
+	for i := 0; i < 3; i++ {
+		if _, locked := throttle.Check("user", "ip", now); locked {
+			t.Fatalf("attempt %d locked out", i)
+		}
+	}
+	if _, locked := throttle.Check("user", "ip", now); !locked {
+		t.Fatal("attempt past the limit while the others are pending was allowed")
+	}
+
+	// released attempts give their reservation back
+	throttle.Release("user", "ip")
+	if _, locked := throttle.Check("user", "ip", now); locked {
+		t.Fatal("attempt after a release locked out")
+	}
+}
+
+func TestLoginThrottleSuccessKeepsPendingAttempts(t *testing.T) {
+	throttle := newTestThrottle()
+	now := time.Unix(1000, 0)
+
+	throttle.Check("user", "ip", now)
+	throttle.Failure("user", "ip", now)
+	throttle.Check("user", "ip", now)
+	throttle.Check("user", "ip", now)
+	throttle.Success("user", "ip")
+
+	// the failure is forgotten, the attempt still pending is not
+	throttle.Check("user", "ip", now)
+	throttle.Check("user", "ip", now)
+	if _, locked := throttle.Check("user", "ip", now); !locked {
+		t.Fatal("pending attempt was forgotten by the success of another")
+	}
+}
+
+func TestLoginThrottleDelay(t *testing.T) {
+	throttle := newTestThrottle()
+	throttle.MaxAccountFailures = 0
+	throttle.MaxIPFailures = 0
+	throttle.BaseDelay = time.Second
+	throttle.MaxDelay = 4 * time.Second
+	now := time.Unix(1000, 0)
+
+	for i, want := range []time.Duration{0, time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second} {
+		delay, _ := throttle.Check("user", "ip", now)
+		if delay != want {
+			t.Errorf("attempt %d: delay = %v, want %v", i, delay, want)
+		}
+		throttle.Failure("user", "ip", now)
+	}
+}
@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 key of the test vectors in RFC 6238 Appendix
+// B, "12345678901234567890" base32 encoded.
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	// the RFC lists 8 digit codes, the 6 digit ones are their last digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+	for _, tt := range tests {
+		got, err := TOTPCode(rfc6238Secret, TOTPStep(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := tt.want[len(tt.want)-TOTPDigits:]; got != want {
+			t.Errorf("TOTPCode() at %d = %s, want %s", tt.unix, got, want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := TOTPStep(now)
+
+	tests := []struct {
+		name string
+		code string
+		ok   bool
+		step int64
+	}{
+		{"current", "050471", true, step},
+		{"previous period", "081804", true, step - 1},
+		{"surrounding spaces", " 050471 ", true, step},
+		{"two periods ago", codeAt(t, step-2), false, 0},
+		{"next period", codeAt(t, step+1), true, step + 1},
+		{"wrong", "000000", false, 0},
+		{"8 digits", "14050471", false, 0},
+		{"empty", "", false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := ValidateTOTP(rfc6238Secret, tt.code, now)
+			if ok != tt.ok || step != tt.step {
+				t.Errorf("ValidateTOTP(%q) = %d, %v, want %d, %v", tt.code, step, ok, tt.step, tt.ok)
+			}
+		})
+	}
+}
+
+func codeAt(t *testing.T, step int64) string {
+	code, err := TOTPCode(rfc6238Secret, step)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func TestHashRecoveryCode(t *testing.T) {
+	want := HashRecoveryCode("abcd1234-efgh5678")
+	for _, typed := range []string{"ABCD1234-EFGH5678", "abcd1234efgh5678", "abcd 1234 efgh 5678"} {
+		if HashRecoveryCode(typed) != want {
+			t.Errorf("HashRecoveryCode(%q) does not match the issued code", typed)
+		}
+	}
+	if HashRecoveryCode("abcd1234-efgh5679") == want {
+		t.Error("another code has the same hash")
+	}
+}
@@ -0,0 +1,51 @@
+// Package buildinfo tells what the binary was built from. The values are
+// set when linking, see the build target of the Makefile:
+//
+//	go build -ldflags "-X github.com/caquillo07/graphql-server-demo/pkg/buildinfo.Revision=$(git rev-parse HEAD)"
+//
+// Binaries built without them fall back to the VCS info the go command
+// stamps them with.
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+var (
+	// Revision is the VCS revision the binary was built from
+	Revision = "unknown"
+
+	// BuildTime is when the binary was built, in RFC 3339
+	BuildTime = "unknown"
+)
+
+// Info is what the binary was built from.
+type Info struct {
+	Revision  string `json:"revision"`
+	BuildTime string `json:"buildTime"`
+	GoVersion string `json:"goVersion"`
+}
+
+// Get returns the build info of the binary.
+func Get() Info {
+	info := Info{
+		Revision:  Revision,
+		BuildTime: BuildTime,
+		GoVersion: runtime.Version(),
+	}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	for _, setting := range bi.Settings {
+		switch {
+		case setting.Key == "vcs.revision" && info.Revision == "unknown":
+			info.Revision = setting.Value
+		case setting.Key == "vcs.time" && info.BuildTime == "unknown":
+			// the time of the commit, the closest there is to it
+			info.BuildTime = setting.Value
+		}
+	}
+	return info
+}
@@ -0,0 +1,14 @@
+// Package federation implements the parts of the Apollo Federation v1 spec
+// needed for the server to be composed by an Apollo gateway.
+package federation
+
+// Service is the _Service type used by the gateway to fetch the schema of
+// the service.
+type Service struct {
+	// SDL the schema of the service, including the federation directives
+	SDL string
+}
+
+// Entity is any of the types of the _Entity union, the types that have a
+// @key and can be resolved by the service.
+type Entity interface{}
@@ -0,0 +1,143 @@
+package federation
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/vektah/gqlparser/ast"
+)
+
+// types and fields added by the federation spec, these are known to the
+// gateway and must be left out of the SDL.
+var (
+	federationTypes = map[string]bool{
+		"_Any":      true,
+		"_FieldSet": true,
+		"_Service":  true,
+		"_Entity":   true,
+	}
+	federationFields = map[string]bool{
+		"_service":  true,
+		"_entities": true,
+	}
+
+	// federationDirectives are the only directives kept in the SDL, any
+	// other directive only matters to this service.
+	federationDirectives = map[string]bool{
+		"key":      true,
+		"extends":  true,
+		"external": true,
+		"requires": true,
+		"provides": true,
+	}
+)
+
+// PrintSDL prints the schema in the form expected by the gateway from the
+// _service query: the service's own types with their federation
+// directives, without the types and fields added by the federation spec.
+func PrintSDL(schema *ast.Schema) string {
+	var names []string
+	for name, def := range schema.Types {
+		if def.BuiltIn || federationTypes[name] {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for i, name := range names {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		printDefinition(&b, schema.Types[name])
+	}
+	return b.String()
+}
+
+func printDefinition(b *strings.Builder, def *ast.Definition) {
+	printDescription(b, "", def.Description)
+
+	switch def.Kind {
+	case ast.Scalar:
+		b.WriteString("scalar " + def.Name + printDirectives(def.Directives) + "\n")
+	case ast.Union:
+		b.WriteString("union " + def.Name + printDirectives(def.Directives) +
+			" = " + strings.Join(def.Types, " | ") + "\n")
+	case ast.Enum:
+		b.WriteString("enum " + def.Name + printDirectives(def.Directives) + " {\n")
+		for _, v := range def.EnumValues {
+			printDescription(b, "  ", v.Description)
+			b.WriteString("  " + v.Name + printDirectives(v.Directives) + "\n")
+		}
+		b.WriteString("}\n")
+	default:
+		keyword := "type "
+		switch def.Kind {
+		case ast.Interface:
+			keyword = "interface "
+		case ast.InputObject:
+			keyword = "input "
+		}
+
+		b.WriteString(keyword + def.Name)
+		if len(def.Interfaces) > 0 {
+			b.WriteString(" implements " + strings.Join(def.Interfaces, " & "))
+		}
+		b.WriteString(printDirectives(def.Directives) + " {\n")
+		for _, f := range def.Fields {
+			if federationFields[f.Name] || strings.HasPrefix(f.Name, "__") {
+				continue
+			}
+			printDescription(b, "  ", f.Description)
+			b.WriteString("  " + f.Name + printArguments(f.Arguments) + ": " + f.Type.String())
+			if f.DefaultValue != nil {
+				b.WriteString(" = " + f.DefaultValue.String())
+			}
+			b.WriteString(printDirectives(f.Directives) + "\n")
+		}
+		b.WriteString("}\n")
+	}
+}
+
+func printArguments(args ast.ArgumentDefinitionList) string {
+	if len(args) == 0 {
+		return ""
+	}
+
+	printed := make([]string, len(args))
+	for i, a := range args {
+		printed[i] = a.Name + ": " + a.Type.String()
+		if a.DefaultValue != nil {
+			printed[i] += " = " + a.DefaultValue.String()
+		}
+	}
+	return "(" + strings.Join(printed, ", ") + ")"
+}
+
+func printDirectives(directives ast.DirectiveList) string {
+	var b strings.Builder
+	for _, d := range directives {
+		if !federationDirectives[d.Name] {
+			continue
+		}
+
+		b.WriteString(" @" + d.Name)
+		if len(d.Arguments) == 0 {
+			continue
+		}
+		args := make([]string, len(d.Arguments))
+		for i, a := range d.Arguments {
+			args[i] = a.Name + ": " + a.Value.String()
+		}
+		b.WriteString("(" + strings.Join(args, ", ") + ")")
+	}
+	return b.String()
+}
+
+func printDescription(b *strings.Builder, indent, description string) {
+	if description != "" {
+		b.WriteString(indent + strconv.Quote(description) + "\n")
+	}
+}
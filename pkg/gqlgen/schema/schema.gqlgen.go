@@ -2,7 +2,126 @@
 
 package schema
 
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+type AuthPayload struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	User      *User     `json:"user"`
+}
+
+type BulkUserPayload struct {
+	Committed bool              `json:"committed"`
+	Results   []*BulkUserResult `json:"results"`
+}
+
+type BulkUserResult struct {
+	Index int        `json:"index"`
+	User  *User      `json:"user"`
+	Error *UserError `json:"error"`
+}
+
+type CreateUserInput struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+type LoginPayload struct {
+	Session       *AuthPayload `json:"session"`
+	TotpChallenge *string      `json:"totpChallenge"`
+}
+
+type PageInfo struct {
+	HasNextPage bool    `json:"hasNextPage"`
+	EndCursor   *string `json:"endCursor"`
+}
+
+type Session struct {
+	ID         string     `json:"id"`
+	UserAgent  string     `json:"userAgent"`
+	IP         string     `json:"ip"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastSeenAt *time.Time `json:"lastSeenAt"`
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	Current    bool       `json:"current"`
+}
+
+type TotpEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
 type User struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
+	ID            string     `json:"id"`
+	Name          string     `json:"name"`
+	Email         *string    `json:"email"`
+	EmailVerified bool       `json:"emailVerified"`
+	Sessions      []*Session `json:"sessions"`
+}
+
+func (User) Is_Entity() {}
+
+type UserError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type UserSearchConnection struct {
+	Edges    []*UserSearchEdge `json:"edges"`
+	PageInfo *PageInfo         `json:"pageInfo"`
+}
+
+type UserSearchEdge struct {
+	Cursor    string  `json:"cursor"`
+	Node      *User   `json:"node"`
+	Rank      float64 `json:"rank"`
+	Highlight string  `json:"highlight"`
+}
+
+type Role string
+
+const (
+	RoleAdmin Role = "ADMIN"
+	RoleUser  Role = "USER"
+	RoleOwner Role = "OWNER"
+)
+
+var AllRole = []Role{
+	RoleAdmin,
+	RoleUser,
+	RoleOwner,
+}
+
+func (e Role) IsValid() bool {
+	switch e {
+	case RoleAdmin, RoleUser, RoleOwner:
+		return true
+	}
+	return false
+}
+
+func (e Role) String() string {
+	return string(e)
+}
+
+func (e *Role) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = Role(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid Role", str)
+	}
+	return nil
+}
+
+func (e Role) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
 }
@@ -0,0 +1,30 @@
+package server
+
+import (
+	"context"
+
+	"github.com/caquillo07/graphql-server-demo/pkg/federation"
+)
+
+// FederationResolver resolves the fields added to Query by the federation
+// spec.
+type FederationResolver interface {
+	Service(ctx context.Context) (*federation.Service, error)
+	Entities(ctx context.Context, representations []map[string]interface{}) ([]federation.Entity, error)
+}
+
+// Federation implements the federation fields of QueryResolver. Their
+// names start with an underscore, so the generated methods are unexported
+// and can only be implemented from this package: embed Federation in the
+// query resolver to satisfy QueryResolver.
+type Federation struct {
+	Resolver FederationResolver
+}
+
+func (f Federation) _service(ctx context.Context) (*federation.Service, error) {
+	return f.Resolver.Service(ctx)
+}
+
+func (f Federation) _entities(ctx context.Context, representations []map[string]interface{}) ([]federation.Entity, error) {
+	return f.Resolver.Entities(ctx, representations)
+}
@@ -0,0 +1,21 @@
+// Package logging holds the level of the global logger, so it can be
+// changed while the server runs.
+package logging
+
+import "go.uber.org/zap"
+
+// Level is the level of the global logger. The admin listener serves it at
+// /loglevel, to turn on debug logs without restarting.
+var Level = zap.NewAtomicLevel()
+
+// NewLogger builds the logger to use as the global one, at Level. The
+// development one starts at debug level and prints human readable lines.
+func NewLogger(development bool) (*zap.Logger, error) {
+	config := zap.NewProductionConfig()
+	if development {
+		config = zap.NewDevelopmentConfig()
+	}
+	Level.SetLevel(config.Level.Level())
+	config.Level = Level
+	return config.Build()
+}
@@ -0,0 +1,45 @@
+package mail
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// LogMailer does not send emails, it appends them to a file or writes them
+// to the log instead. It is meant for local development.
+type LogMailer struct {
+	// Path the file the emails are appended to, when empty they are logged
+	Path string
+
+	// From the sender of the emails
+	From string
+
+	mu sync.Mutex
+}
+
+// Send writes the message to the file or the log.
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	if m.Path == "" {
+		zap.L().Info("email",
+			zap.String("to", msg.To),
+			zap.String("subject", msg.Subject),
+			zap.String("body", msg.Body))
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, err := os.OpenFile(m.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(format(m.From, msg, time.Now()), "\r\n\r\n"...)); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
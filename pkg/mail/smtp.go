@@ -0,0 +1,39 @@
+package mail
+
+import (
+	"context"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// SMTPMailer sends emails through an SMTP server, using STARTTLS when the
+// server supports it.
+type SMTPMailer struct {
+	// Host and Port of the SMTP server
+	Host string
+	Port string
+
+	// Username and Password authenticate with PLAIN auth when set
+	Username string
+	Password string
+
+	// From the sender of the emails
+	From string
+}
+
+// Send sends the message. net/smtp does not take a context, so the send is
+// not interrupted when ctx is cancelled.
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	if strings.ContainsAny(msg.To, "\r\n") {
+		return errInvalidAddress
+	}
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+	addr := net.JoinHostPort(m.Host, m.Port)
+	return smtp.SendMail(addr, auth, m.From, []string{msg.To}, format(m.From, msg, time.Now()))
+}
@@ -0,0 +1,69 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/lib/pq"
+)
+
+// ErrAPIKeyNotFound is returned when an API key does not exist.
+var ErrAPIKeyNotFound = errors.New("api key not found")
+
+// APIKey is a long-lived credential used by services. Only a hash of its
+// secret is stored, the key is looked up by its public prefix.
+type APIKey struct {
+	// ID the unique ID for the key
+	ID uuid.UUID
+
+	// Name describes who the key was given to
+	Name string
+
+	// Prefix the public part of the key, used to look it up
+	Prefix string
+
+	// Hash the hash of the secret part of the key
+	Hash string
+
+	// Scopes the roles granted to the callers using the key
+	Scopes pq.StringArray `gorm:"type:text[]"`
+
+	// ExpiresAt the date after which the key is rejected, nil if it does
+	// not expire
+	ExpiresAt *time.Time
+
+	// LastUsedAt the date the key was last used, updated asynchronously
+	LastUsedAt *time.Time
+
+	// RevokedAt the date the key was revoked
+	RevokedAt *time.Time
+
+	// CreatedAt the date the key was created
+	CreatedAt time.Time
+}
+
+// Active reports whether the key can still be used at the given time.
+func (k *APIKey) Active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// APIKeyRepository is the storage used for API keys.
+type APIKeyRepository interface {
+	// CreateAPIKey stores a new key, assigning its ID when not set.
+	CreateAPIKey(ctx context.Context, key *APIKey) error
+
+	// FindAPIKeyByPrefix returns the key with the prefix, or
+	// ErrAPIKeyNotFound.
+	FindAPIKeyByPrefix(ctx context.Context, prefix string) (*APIKey, error)
+
+	// ListAPIKeys returns every key, revoked and expired ones included.
+	ListAPIKeys(ctx context.Context) ([]*APIKey, error)
+
+	// RevokeAPIKey revokes the key, or returns ErrAPIKeyNotFound.
+	RevokeAPIKey(ctx context.Context, id uuid.UUID) error
+
+	// TouchAPIKey records when the key was last used.
+	TouchAPIKey(ctx context.Context, id uuid.UUID, usedAt time.Time) error
+}
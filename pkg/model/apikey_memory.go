@@ -0,0 +1,90 @@
+package model
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+type memoryAPIKeyRepository struct {
+	mu   sync.RWMutex
+	keys []*APIKey
+}
+
+// NewMemoryAPIKeyRepository returns an APIKeyRepository that keeps the
+// keys in memory.
+func NewMemoryAPIKeyRepository() APIKeyRepository {
+	return &memoryAPIKeyRepository{}
+}
+
+func (r *memoryAPIKeyRepository) CreateAPIKey(ctx context.Context, key *APIKey) error {
+	if key.ID == uuid.Nil {
+		id, err := uuid.NewV4()
+		if err != nil {
+			return err
+		}
+		key.ID = id
+	}
+	if key.CreatedAt.IsZero() {
+		key.CreatedAt = time.Now()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored := *key
+	r.keys = append(r.keys, &stored)
+	return nil
+}
+
+func (r *memoryAPIKeyRepository) FindAPIKeyByPrefix(ctx context.Context, prefix string) (*APIKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, k := range r.keys {
+		if k.Prefix == prefix {
+			key := *k
+			return &key, nil
+		}
+	}
+	return nil, ErrAPIKeyNotFound
+}
+
+func (r *memoryAPIKeyRepository) ListAPIKeys(ctx context.Context) ([]*APIKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	keys := make([]*APIKey, len(r.keys))
+	for i, k := range r.keys {
+		key := *k
+		keys[i] = &key
+	}
+	return keys, nil
+}
+
+func (r *memoryAPIKeyRepository) RevokeAPIKey(ctx context.Context, id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, k := range r.keys {
+		if k.ID == id && k.RevokedAt == nil {
+			now := time.Now()
+			k.RevokedAt = &now
+			return nil
+		}
+	}
+	return ErrAPIKeyNotFound
+}
+
+func (r *memoryAPIKeyRepository) TouchAPIKey(ctx context.Context, id uuid.UUID, usedAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, k := range r.keys {
+		if k.ID == id && (k.LastUsedAt == nil || k.LastUsedAt.Before(usedAt)) {
+			k.LastUsedAt = &usedAt
+		}
+	}
+	return nil
+}
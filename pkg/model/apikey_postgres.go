@@ -0,0 +1,79 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jinzhu/gorm"
+)
+
+type postgresAPIKeyRepository struct {
+	db *contextDBs
+}
+
+// NewPostgresAPIKeyRepository returns an APIKeyRepository backed by
+// postgres.
+func NewPostgresAPIKeyRepository(db *gorm.DB) APIKeyRepository {
+	return &postgresAPIKeyRepository{db: newContextDBs(db)}
+}
+
+func (r *postgresAPIKeyRepository) CreateAPIKey(ctx context.Context, key *APIKey) error {
+	if key.ID == uuid.Nil {
+		id, err := uuid.NewV4()
+		if err != nil {
+			return err
+		}
+		key.ID = id
+	}
+	db, done := r.db.withContext(ctx)
+	defer done()
+	return db.Create(key).Error
+}
+
+func (r *postgresAPIKeyRepository) FindAPIKeyByPrefix(ctx context.Context, prefix string) (*APIKey, error) {
+	var key APIKey
+	db, done := r.db.withContext(ctx)
+	defer done()
+	err := db.Where("prefix = ?", prefix).First(&key).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (r *postgresAPIKeyRepository) ListAPIKeys(ctx context.Context) ([]*APIKey, error) {
+	var keys []*APIKey
+	db, done := r.db.withContext(ctx)
+	defer done()
+	if err := db.Order("created_at").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (r *postgresAPIKeyRepository) RevokeAPIKey(ctx context.Context, id uuid.UUID) error {
+	db, done := r.db.withContext(ctx)
+	defer done()
+	res := db.Model(&APIKey{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now())
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+func (r *postgresAPIKeyRepository) TouchAPIKey(ctx context.Context, id uuid.UUID, usedAt time.Time) error {
+	db, done := r.db.withContext(ctx)
+	defer done()
+	return db.Model(&APIKey{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", id, usedAt).
+		Update("last_used_at", usedAt).Error
+}
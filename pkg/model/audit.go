@@ -0,0 +1,51 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// AuditRecord is an entry of the audit trail, kept for actions that must
+// be traceable to who made them.
+type AuditRecord struct {
+	// ID the unique ID for the record
+	ID uuid.UUID
+
+	// Actor the subject of the principal that made the action
+	Actor string
+
+	// ImpersonatedBy the subject of the admin impersonating the actor,
+	// empty when the action was not made under impersonation
+	ImpersonatedBy string
+
+	// Action what was done, e.g. impersonate or mutation
+	Action string
+
+	// Details describes the action, such as the operation name
+	Details string
+
+	// CreatedAt the date of the action
+	CreatedAt time.Time
+}
+
+// AuditRepository is the storage of the audit trail.
+type AuditRepository interface {
+	// CreateAuditRecord stores a new record, assigning its ID when not set.
+	CreateAuditRecord(ctx context.Context, record *AuditRecord) error
+}
+
+func setAuditRecordDefaults(record *AuditRecord) error {
+	if record.ID == uuid.Nil {
+		id, err := uuid.NewV4()
+		if err != nil {
+			return err
+		}
+		record.ID = id
+	}
+	if record.CreatedAt.IsZero() {
+		record.CreatedAt = time.Now()
+	}
+	return nil
+}
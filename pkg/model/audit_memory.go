@@ -0,0 +1,29 @@
+package model
+
+import (
+	"context"
+	"sync"
+)
+
+type memoryAuditRepository struct {
+	mu      sync.Mutex
+	records []*AuditRecord
+}
+
+// NewMemoryAuditRepository returns an AuditRepository that keeps the
+// records in memory.
+func NewMemoryAuditRepository() AuditRepository {
+	return &memoryAuditRepository{}
+}
+
+func (r *memoryAuditRepository) CreateAuditRecord(ctx context.Context, record *AuditRecord) error {
+	if err := setAuditRecordDefaults(record); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored := *record
+	r.records = append(r.records, &stored)
+	return nil
+}
@@ -0,0 +1,25 @@
+package model
+
+import (
+	"context"
+
+	"github.com/jinzhu/gorm"
+)
+
+type postgresAuditRepository struct {
+	db *contextDBs
+}
+
+// NewPostgresAuditRepository returns an AuditRepository backed by postgres.
+func NewPostgresAuditRepository(db *gorm.DB) AuditRepository {
+	return &postgresAuditRepository{db: newContextDBs(db)}
+}
+
+func (r *postgresAuditRepository) CreateAuditRecord(ctx context.Context, record *AuditRecord) error {
+	if err := setAuditRecordDefaults(record); err != nil {
+		return err
+	}
+	db, done := r.db.withContext(ctx)
+	defer done()
+	return db.Create(record).Error
+}
@@ -0,0 +1,85 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+
+	"github.com/jinzhu/gorm"
+)
+
+// contextDB runs the statements gorm makes under a context, since gorm
+// itself has no way to pass one.
+type contextDB struct {
+	db  *sql.DB
+	ctx context.Context
+}
+
+func (c *contextDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return c.db.ExecContext(c.ctx, query, args...)
+}
+
+func (c *contextDB) Prepare(query string) (*sql.Stmt, error) {
+	return c.db.PrepareContext(c.ctx, query)
+}
+
+func (c *contextDB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return c.db.QueryContext(c.ctx, query, args...)
+}
+
+func (c *contextDB) QueryRow(query string, args ...interface{}) *sql.Row {
+	return c.db.QueryRowContext(c.ctx, query, args...)
+}
+
+func (c *contextDB) Begin() (*sql.Tx, error) {
+	return c.db.BeginTx(c.ctx, nil)
+}
+
+// contextDBs hands out the dbs a repository runs its statements on, each
+// opened over its own contextDB so the context can be set for the call
+// using it.
+type contextDBs struct {
+	db      *gorm.DB
+	sqlDB   *sql.DB
+	dialect string
+	pool    sync.Pool
+}
+
+type pooledDB struct {
+	conn *contextDB
+	db   *gorm.DB
+}
+
+func newContextDBs(db *gorm.DB) *contextDBs {
+	c := &contextDBs{db: db, sqlDB: db.DB(), dialect: db.Dialect().GetName()}
+	c.pool.New = func() interface{} {
+		conn := &contextDB{db: c.sqlDB, ctx: context.Background()}
+		// gorm only fails to open when it is given no connection
+		cdb, _ := gorm.Open(c.dialect, conn)
+		return &pooledDB{conn: conn, db: cdb}
+	}
+	return c
+}
+
+// withContext returns a db whose statements are cancelled once the context
+// is done, e.g. when the deadline of the operation making them passes, and
+// the func to call once the call is done with it. Transactions are already
+// bound to the context they were started with.
+//
+// gorm v1 cannot swap the connection of a db, so the db is one opened over
+// the same pool and kept for the later calls. It starts from gorm's
+// defaults: what was set on the repository's db after it was opened, such
+// as LogMode, SetLogger, SingularTable or callbacks, does not apply to the
+// statements. Set those on the *sql.DB or the driver instead, as the
+// tracing driver does.
+func (c *contextDBs) withContext(ctx context.Context) (*gorm.DB, func()) {
+	if c.sqlDB == nil {
+		return c.db, func() {}
+	}
+	p := c.pool.Get().(*pooledDB)
+	p.conn.ctx = ctx
+	return p.db, func() {
+		p.conn.ctx = context.Background()
+		c.pool.Put(p)
+	}
+}
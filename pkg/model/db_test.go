@@ -0,0 +1,40 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+)
+
+func TestContextDBsWithContext(t *testing.T) {
+	// nothing listens there, the statements fail before or when connecting
+	sqlDB, err := sql.Open("postgres", "postgres://localhost:1/none?sslmode=disable&connect_timeout=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqlDB.Close()
+	// the ping gorm makes on open fails the same way
+	db, _ := gorm.Open("postgres", sqlDB)
+	dbs := newContextDBs(db)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	cdb, done := dbs.withContext(ctx)
+	err = cdb.Exec("SELECT 1").Error
+	done()
+	if err != context.Canceled {
+		t.Fatalf("got %v with a cancelled context, want %v", err, context.Canceled)
+	}
+
+	// the db goes back to the pool without the context of the last call
+	for i := 0; i < 2; i++ {
+		cdb, done := dbs.withContext(context.Background())
+		err := cdb.Exec("SELECT 1").Error
+		done()
+		if err == nil || err == context.Canceled {
+			t.Fatalf("got %v, want the error connecting", err)
+		}
+	}
+}
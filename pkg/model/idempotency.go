@@ -0,0 +1,48 @@
+package model
+
+import (
+	"context"
+	"time"
+)
+
+// IdempotencyRecord is the stored outcome of a request sent with an
+// idempotency key, replayed when the same request is retried.
+type IdempotencyRecord struct {
+	// Key the idempotency key sent by the client
+	Key string `gorm:"primary_key"`
+
+	// RequestHash the hash of the operation and variables of the request
+	RequestHash string
+
+	// StatusCode the HTTP status code of the response
+	StatusCode int
+
+	// Response the serialized response body
+	Response []byte
+
+	// CreatedAt the date the record was created
+	CreatedAt time.Time
+
+	// ExpiresAt the date after which the record is no longer replayed
+	ExpiresAt time.Time
+}
+
+// TableName sets the table used by gorm for the records.
+func (IdempotencyRecord) TableName() string {
+	return "idempotency_keys"
+}
+
+// IdempotencyRepository is the storage used for idempotency records.
+type IdempotencyRepository interface {
+	// FindIdempotencyRecord returns the unexpired record stored under the
+	// key, or nil when there is none.
+	FindIdempotencyRecord(ctx context.Context, key string) (*IdempotencyRecord, error)
+
+	// SaveIdempotencyRecord stores the record, replacing any expired record
+	// with the same key.
+	SaveIdempotencyRecord(ctx context.Context, record *IdempotencyRecord) error
+
+	// DeleteExpiredIdempotencyRecords removes the records that expired
+	// before the given time.
+	DeleteExpiredIdempotencyRecords(ctx context.Context, before time.Time) error
+}
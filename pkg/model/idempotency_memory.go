@@ -0,0 +1,52 @@
+package model
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type memoryIdempotencyRepository struct {
+	mu      sync.Mutex
+	records map[string]IdempotencyRecord
+}
+
+// NewMemoryIdempotencyRepository returns an IdempotencyRepository that
+// keeps the records in memory.
+func NewMemoryIdempotencyRepository() IdempotencyRepository {
+	return &memoryIdempotencyRepository{records: map[string]IdempotencyRecord{}}
+}
+
+func (r *memoryIdempotencyRepository) FindIdempotencyRecord(ctx context.Context, key string) (*IdempotencyRecord, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	record, ok := r.records[key]
+	if !ok || !record.ExpiresAt.After(time.Now()) {
+		return nil, nil
+	}
+	return &record, nil
+}
+
+func (r *memoryIdempotencyRepository) SaveIdempotencyRecord(ctx context.Context, record *IdempotencyRecord) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if existing, ok := r.records[record.Key]; ok && existing.ExpiresAt.After(record.CreatedAt) {
+		return nil
+	}
+	r.records[record.Key] = *record
+	return nil
+}
+
+func (r *memoryIdempotencyRepository) DeleteExpiredIdempotencyRecords(ctx context.Context, before time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for key, record := range r.records {
+		if !record.ExpiresAt.After(before) {
+			delete(r.records, key)
+		}
+	}
+	return nil
+}
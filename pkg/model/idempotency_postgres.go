@@ -0,0 +1,55 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+type postgresIdempotencyRepository struct {
+	db *contextDBs
+}
+
+// NewPostgresIdempotencyRepository returns an IdempotencyRepository backed
+// by postgres.
+func NewPostgresIdempotencyRepository(db *gorm.DB) IdempotencyRepository {
+	return &postgresIdempotencyRepository{db: newContextDBs(db)}
+}
+
+func (r *postgresIdempotencyRepository) FindIdempotencyRecord(ctx context.Context, key string) (*IdempotencyRecord, error) {
+	var record IdempotencyRecord
+	db, done := r.db.withContext(ctx)
+	defer done()
+	err := db.Where("key = ? AND expires_at > ?", key, time.Now()).First(&record).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+func (r *postgresIdempotencyRepository) SaveIdempotencyRecord(ctx context.Context, record *IdempotencyRecord) error {
+	db, done := r.db.withContext(ctx)
+	defer done()
+	return db.Exec(`
+		INSERT INTO idempotency_keys (key, request_hash, status_code, response, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET
+			request_hash = excluded.request_hash,
+			status_code = excluded.status_code,
+			response = excluded.response,
+			created_at = excluded.created_at,
+			expires_at = excluded.expires_at
+		WHERE idempotency_keys.expires_at <= excluded.created_at`,
+		record.Key, record.RequestHash, record.StatusCode, record.Response, record.CreatedAt, record.ExpiresAt,
+	).Error
+}
+
+func (r *postgresIdempotencyRepository) DeleteExpiredIdempotencyRecords(ctx context.Context, before time.Time) error {
+	db, done := r.db.withContext(ctx)
+	defer done()
+	return db.Where("expires_at <= ?", before).Delete(IdempotencyRecord{}).Error
+}
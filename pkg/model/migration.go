@@ -0,0 +1,62 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"io/ioutil"
+
+	"github.com/jinzhu/gorm"
+	"github.com/mattes/migrate/source"
+)
+
+// MigrationStatus is the version the database was migrated to, and the
+// version of the newest migration there is.
+type MigrationStatus struct {
+	Version uint
+	Latest  uint
+
+	// Dirty is set when the last migration failed half way
+	Dirty bool
+}
+
+// Pending reports whether there are migrations left to apply.
+func (s MigrationStatus) Pending() bool {
+	return s.Version < s.Latest
+}
+
+// LatestMigration returns the version of the newest migration in the
+// directory, 0 when there are none.
+func LatestMigration(dir string) (uint, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	var latest uint
+	for _, f := range files {
+		m, err := source.Parse(f.Name())
+		if err != nil {
+			continue
+		}
+		if m.Version > latest {
+			latest = m.Version
+		}
+	}
+	return latest, nil
+}
+
+// GetMigrationStatus reads the version the database was migrated to from
+// the table the migrate command keeps it in.
+func GetMigrationStatus(ctx context.Context, db *gorm.DB, latest uint) (MigrationStatus, error) {
+	status := MigrationStatus{Latest: latest}
+	row := db.DB().QueryRowContext(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1")
+	var version int64
+	err := row.Scan(&version, &status.Dirty)
+	if err == sql.ErrNoRows {
+		return status, nil
+	}
+	if err != nil {
+		return MigrationStatus{}, err
+	}
+	status.Version = uint(version)
+	return status, nil
+}
@@ -0,0 +1,80 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// ErrSessionNotFound is returned when a session does not exist.
+var ErrSessionNotFound = errors.New("session not found")
+
+// Session is a user's login, identified by an opaque token of which only
+// the hash is stored.
+type Session struct {
+	// ID the unique ID for the session
+	ID uuid.UUID
+
+	// UserID the ID of the user that logged in
+	UserID uuid.UUID
+
+	// TokenHash the hash of the session token
+	TokenHash string
+
+	// UserAgent the User-Agent header of the login request
+	UserAgent string
+
+	// IP the address the login request came from
+	IP string
+
+	// ImpersonatedBy the subject of the admin the session was issued to,
+	// when it is impersonating the user
+	ImpersonatedBy string
+
+	// CreatedAt the date the session was created
+	CreatedAt time.Time
+
+	// ExpiresAt the date after which the session is no longer valid
+	ExpiresAt time.Time
+
+	// LastSeenAt the date the session was last used, updated periodically
+	LastSeenAt *time.Time
+
+	// RevokedAt the date the session was revoked, by logging out
+	RevokedAt *time.Time
+}
+
+// Active reports whether the session can still be used at the given time.
+func (s *Session) Active(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
+
+// SessionRepository is the storage used for sessions.
+type SessionRepository interface {
+	// CreateSession stores a new session, assigning its ID when not set.
+	CreateSession(ctx context.Context, session *Session) error
+
+	// FindSessionByTokenHash returns the session with the token hash, or
+	// ErrSessionNotFound.
+	FindSessionByTokenHash(ctx context.Context, tokenHash string) (*Session, error)
+
+	// GetSession returns the session with the given ID, or
+	// ErrSessionNotFound.
+	GetSession(ctx context.Context, id uuid.UUID) (*Session, error)
+
+	// ListSessions returns the active sessions of the user, newest first.
+	ListSessions(ctx context.Context, userID uuid.UUID) ([]*Session, error)
+
+	// RevokeSession revokes the session, or returns ErrSessionNotFound.
+	RevokeSession(ctx context.Context, id uuid.UUID) error
+
+	// RevokeUserSessions revokes every active session of the user,
+	// returning the IDs of the revoked sessions.
+	RevokeUserSessions(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error)
+
+	// TouchSession records that the session was used at the given time,
+	// unless it was already seen later.
+	TouchSession(ctx context.Context, id uuid.UUID, seenAt time.Time) error
+}
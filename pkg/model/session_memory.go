@@ -0,0 +1,122 @@
+package model
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+type memorySessionRepository struct {
+	mu       sync.RWMutex
+	sessions []*Session
+}
+
+// NewMemorySessionRepository returns a SessionRepository that keeps the
+// sessions in memory.
+func NewMemorySessionRepository() SessionRepository {
+	return &memorySessionRepository{}
+}
+
+func (r *memorySessionRepository) CreateSession(ctx context.Context, session *Session) error {
+	if session.ID == uuid.Nil {
+		id, err := uuid.NewV4()
+		if err != nil {
+			return err
+		}
+		session.ID = id
+	}
+	if session.CreatedAt.IsZero() {
+		session.CreatedAt = time.Now()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored := *session
+	r.sessions = append(r.sessions, &stored)
+	return nil
+}
+
+func (r *memorySessionRepository) FindSessionByTokenHash(ctx context.Context, tokenHash string) (*Session, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, s := range r.sessions {
+		if s.TokenHash == tokenHash {
+			session := *s
+			return &session, nil
+		}
+	}
+	return nil, ErrSessionNotFound
+}
+
+func (r *memorySessionRepository) GetSession(ctx context.Context, id uuid.UUID) (*Session, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, s := range r.sessions {
+		if s.ID == id {
+			session := *s
+			return &session, nil
+		}
+	}
+	return nil, ErrSessionNotFound
+}
+
+func (r *memorySessionRepository) ListSessions(ctx context.Context, userID uuid.UUID) ([]*Session, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now()
+	var sessions []*Session
+	for i := len(r.sessions) - 1; i >= 0; i-- {
+		s := r.sessions[i]
+		if s.UserID == userID && s.Active(now) {
+			session := *s
+			sessions = append(sessions, &session)
+		}
+	}
+	return sessions, nil
+}
+
+func (r *memorySessionRepository) RevokeSession(ctx context.Context, id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, s := range r.sessions {
+		if s.ID == id && s.RevokedAt == nil {
+			now := time.Now()
+			s.RevokedAt = &now
+			return nil
+		}
+	}
+	return ErrSessionNotFound
+}
+
+func (r *memorySessionRepository) RevokeUserSessions(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	var ids []uuid.UUID
+	for _, s := range r.sessions {
+		if s.UserID == userID && s.RevokedAt == nil {
+			s.RevokedAt = &now
+			ids = append(ids, s.ID)
+		}
+	}
+	return ids, nil
+}
+
+func (r *memorySessionRepository) TouchSession(ctx context.Context, id uuid.UUID, seenAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, s := range r.sessions {
+		if s.ID == id && (s.LastSeenAt == nil || s.LastSeenAt.Before(seenAt)) {
+			s.LastSeenAt = &seenAt
+		}
+	}
+	return nil
+}
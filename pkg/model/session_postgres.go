@@ -0,0 +1,116 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jinzhu/gorm"
+)
+
+type postgresSessionRepository struct {
+	db *contextDBs
+}
+
+// NewPostgresSessionRepository returns a SessionRepository backed by
+// postgres.
+func NewPostgresSessionRepository(db *gorm.DB) SessionRepository {
+	return &postgresSessionRepository{db: newContextDBs(db)}
+}
+
+func (r *postgresSessionRepository) CreateSession(ctx context.Context, session *Session) error {
+	if session.ID == uuid.Nil {
+		id, err := uuid.NewV4()
+		if err != nil {
+			return err
+		}
+		session.ID = id
+	}
+	db, done := r.db.withContext(ctx)
+	defer done()
+	return db.Create(session).Error
+}
+
+func (r *postgresSessionRepository) FindSessionByTokenHash(ctx context.Context, tokenHash string) (*Session, error) {
+	var session Session
+	db, done := r.db.withContext(ctx)
+	defer done()
+	err := db.Where("token_hash = ?", tokenHash).First(&session).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (r *postgresSessionRepository) GetSession(ctx context.Context, id uuid.UUID) (*Session, error) {
+	var session Session
+	db, done := r.db.withContext(ctx)
+	defer done()
+	err := db.Where("id = ?", id).First(&session).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (r *postgresSessionRepository) ListSessions(ctx context.Context, userID uuid.UUID) ([]*Session, error) {
+	var sessions []*Session
+	db, done := r.db.withContext(ctx)
+	defer done()
+	err := db.
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("created_at DESC").
+		Find(&sessions).Error
+	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func (r *postgresSessionRepository) RevokeSession(ctx context.Context, id uuid.UUID) error {
+	db, done := r.db.withContext(ctx)
+	defer done()
+	res := db.Model(&Session{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now())
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+func (r *postgresSessionRepository) RevokeUserSessions(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error) {
+	var revoked []*Session
+	db, done := r.db.withContext(ctx)
+	defer done()
+	err := db.Raw(`
+		UPDATE sessions SET revoked_at = ?
+		WHERE user_id = ? AND revoked_at IS NULL
+		RETURNING id`, time.Now(), userID).Scan(&revoked).Error
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uuid.UUID, len(revoked))
+	for i, session := range revoked {
+		ids[i] = session.ID
+	}
+	return ids, nil
+}
+
+func (r *postgresSessionRepository) TouchSession(ctx context.Context, id uuid.UUID, seenAt time.Time) error {
+	db, done := r.db.withContext(ctx)
+	defer done()
+	return db.Model(&Session{}).
+		Where("id = ? AND (last_seen_at IS NULL OR last_seen_at < ?)", id, seenAt).
+		Update("last_seen_at", seenAt).Error
+}
@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/gofrs/uuid"
+	"github.com/lib/pq"
 )
 
 // User represents a user in the database
@@ -14,6 +15,39 @@ type User struct {
 	// Name the user's first name
 	Name string
 
+	// Email the user's email address, unique across users
+	Email string
+
+	// EmailVerifiedAt the date the user proved they own their email, nil
+	// while it is not verified
+	EmailVerifiedAt *time.Time
+
+	// PasswordHash the encoded hash of the user's password, empty for
+	// users that cannot log in with a password
+	PasswordHash string
+
+	// OIDCSubject the sub claim of the user at the OpenID Connect
+	// provider, empty for users that never logged in through it
+	OIDCSubject string `gorm:"column:oidc_subject"`
+
+	// Roles the roles granted to the user when logged in with a session
+	Roles pq.StringArray `gorm:"type:text[]"`
+
+	// TOTPSecret the base32 secret of the user's authenticator, set when
+	// enrolling and kept until TOTP is disabled
+	TOTPSecret string
+
+	// TOTPEnabled whether the enrollment was confirmed, logging in then
+	// requires a TOTP or recovery code
+	TOTPEnabled bool
+
+	// TOTPLastStep the time step of the last accepted TOTP code, so codes
+	// cannot be replayed
+	TOTPLastStep int64
+
+	// RecoveryCodes the hashes of the unused recovery codes
+	RecoveryCodes pq.StringArray `gorm:"type:text[]"`
+
 	// CreatedAt the date the user was created
 	CreatedAt time.Time
 
@@ -23,8 +57,3 @@ type User struct {
 	// DeletedAt the date the user was deleted
 	DeletedAt *time.Time
 }
-
-// CreateUser creates a new user in the database.
-func CreateUser(user *User) error {
-	return nil
-}
@@ -0,0 +1,316 @@
+package model
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+type memoryUserRepository struct {
+	mu    sync.RWMutex
+	users []*User
+}
+
+// NewMemoryUserRepository returns a UserRepository that keeps the users in
+// memory, meant for development and tests where no database is available.
+func NewMemoryUserRepository() UserRepository {
+	return &memoryUserRepository{}
+}
+
+func (r *memoryUserRepository) CreateUser(ctx context.Context, user *User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.createUser(user)
+}
+
+func (r *memoryUserRepository) CreateUsers(ctx context.Context, users []*User, partial bool) ([]error, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	snapshot := r.snapshot()
+	errs := make([]error, len(users))
+	for i, user := range users {
+		errs[i] = r.createUser(user)
+	}
+	if !partial && hasErrors(errs) {
+		r.users = snapshot
+	}
+	return errs, nil
+}
+
+func (r *memoryUserRepository) DeleteUser(ctx context.Context, id uuid.UUID) (*User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.deleteUser(id)
+}
+
+func (r *memoryUserRepository) DeleteUsers(ctx context.Context, ids []uuid.UUID, partial bool) ([]*User, []error, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	snapshot := r.snapshot()
+	users := make([]*User, len(ids))
+	errs := make([]error, len(ids))
+	for i, id := range ids {
+		users[i], errs[i] = r.deleteUser(id)
+	}
+	if !partial && hasErrors(errs) {
+		r.users = snapshot
+	}
+	return users, errs, nil
+}
+
+// createUser stores the user, the caller must hold the write lock.
+func (r *memoryUserRepository) createUser(user *User) error {
+	for _, u := range r.users {
+		if user.Email != "" && strings.EqualFold(u.Email, user.Email) {
+			return ErrEmailTaken
+		}
+	}
+	if err := setUserDefaults(user); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = now
+	}
+	if user.UpdatedAt.IsZero() {
+		user.UpdatedAt = now
+	}
+
+	stored := *user
+	r.users = append(r.users, &stored)
+	return nil
+}
+
+// deleteUser marks the user as deleted, the caller must hold the write
+// lock. The stored user is replaced rather than modified so snapshots are
+// left untouched.
+func (r *memoryUserRepository) deleteUser(id uuid.UUID) (*User, error) {
+	for i, u := range r.users {
+		if u.ID != id || u.DeletedAt != nil {
+			continue
+		}
+
+		deleted := *u
+		now := time.Now()
+		deleted.DeletedAt = &now
+		r.users[i] = &deleted
+
+		user := *u
+		return &user, nil
+	}
+	return nil, ErrUserNotFound
+}
+
+// snapshot copies the list of users so it can be restored when a bulk
+// operation fails, the caller must hold the write lock.
+func (r *memoryUserRepository) snapshot() []*User {
+	return append([]*User(nil), r.users...)
+}
+
+func (r *memoryUserRepository) GetUser(ctx context.Context, id uuid.UUID) (*User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, u := range r.users {
+		if u.ID == id && u.DeletedAt == nil {
+			user := *u
+			return &user, nil
+		}
+	}
+	return nil, ErrUserNotFound
+}
+
+func (r *memoryUserRepository) FindUserByEmail(ctx context.Context, email string) (*User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, u := range r.users {
+		if u.DeletedAt == nil && strings.EqualFold(u.Email, email) {
+			user := *u
+			return &user, nil
+		}
+	}
+	return nil, ErrUserNotFound
+}
+
+func (r *memoryUserRepository) FindUserByOIDCSubject(ctx context.Context, subject string) (*User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, u := range r.users {
+		if u.DeletedAt == nil && subject != "" && u.OIDCSubject == subject {
+			user := *u
+			return &user, nil
+		}
+	}
+	return nil, ErrUserNotFound
+}
+
+func (r *memoryUserRepository) UpdateUser(ctx context.Context, user *User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, u := range r.users {
+		if u.ID != user.ID && user.Email != "" && u.DeletedAt == nil && strings.EqualFold(u.Email, user.Email) {
+			return ErrEmailTaken
+		}
+	}
+	return r.updateUser(user.ID, func(u *User) bool {
+		updated := *user
+		updated.CreatedAt = u.CreatedAt
+		*u = updated
+		return true
+	})
+}
+
+func (r *memoryUserRepository) UseTOTPStep(ctx context.Context, id uuid.UUID, step int64) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	used := false
+	err := r.updateUser(id, func(u *User) bool {
+		if u.TOTPLastStep >= step {
+			return false
+		}
+		u.TOTPLastStep = step
+		used = true
+		return true
+	})
+	return used, err
+}
+
+func (r *memoryUserRepository) UseRecoveryCode(ctx context.Context, id uuid.UUID, hash string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	used := false
+	err := r.updateUser(id, func(u *User) bool {
+		for i, h := range u.RecoveryCodes {
+			if h == hash {
+				codes := append([]string(nil), u.RecoveryCodes[:i]...)
+				u.RecoveryCodes = append(codes, u.RecoveryCodes[i+1:]...)
+				used = true
+				return true
+			}
+		}
+		return false
+	})
+	return used, err
+}
+
+// updateUser applies fn to a copy of the user and stores it when fn
+// reports a change, the caller must hold the write lock. As with
+// deleteUser the stored user is replaced so snapshots are left untouched.
+func (r *memoryUserRepository) updateUser(id uuid.UUID, fn func(u *User) bool) error {
+	for i, u := range r.users {
+		if u.ID != id || u.DeletedAt != nil {
+			continue
+		}
+
+		updated := *u
+		if fn(&updated) {
+			updated.UpdatedAt = time.Now()
+			r.users[i] = &updated
+		}
+		return nil
+	}
+	return ErrUserNotFound
+}
+
+func (r *memoryUserRepository) ListUsers(ctx context.Context) ([]*User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	users := make([]*User, 0, len(r.users))
+	for _, u := range r.users {
+		if u.DeletedAt != nil {
+			continue
+		}
+		user := *u
+		users = append(users, &user)
+	}
+	return users, nil
+}
+
+// SearchUsers matches every query term as a prefix of a word in the
+// user's name. The rank is the fraction of the name's words that matched,
+// which is close enough to postgres' ordering for development.
+func (r *memoryUserRepository) SearchUsers(ctx context.Context, query string, limit, offset int) ([]*UserSearchResult, error) {
+	terms := searchTokens(query)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	r.mu.RLock()
+	var results []*UserSearchResult
+	for _, u := range r.users {
+		if u.DeletedAt != nil {
+			continue
+		}
+		if result, ok := matchUser(u, terms); ok {
+			results = append(results, result)
+		}
+	}
+	r.mu.RUnlock()
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Rank != results[j].Rank {
+			return results[i].Rank > results[j].Rank
+		}
+		return results[i].User.ID.String() < results[j].User.ID.String()
+	})
+
+	if offset >= len(results) {
+		return nil, nil
+	}
+	results = results[offset:]
+	if limit < len(results) {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+// matchUser checks whether all the terms are found in the user's name and
+// builds the ranked, highlighted result when they are.
+func matchUser(u *User, terms []string) (*UserSearchResult, bool) {
+	words := strings.Fields(u.Name)
+	matched := make([]bool, len(words))
+	for _, term := range terms {
+		found := false
+		for i, w := range words {
+			for _, token := range searchTokens(w) {
+				if strings.HasPrefix(token, term) {
+					matched[i] = true
+					found = true
+				}
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+
+	hits := 0
+	highlighted := make([]string, len(words))
+	for i, w := range words {
+		highlighted[i] = w
+		if matched[i] {
+			hits++
+			highlighted[i] = HighlightStart + w + HighlightStop
+		}
+	}
+
+	user := *u
+	return &UserSearchResult{
+		User:      &user,
+		Rank:      float64(hits) / float64(len(words)),
+		Highlight: strings.Join(highlighted, " "),
+	}, true
+}
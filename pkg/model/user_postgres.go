@@ -0,0 +1,268 @@
+package model
+
+import (
+	"context"
+	"strings"
+
+	"github.com/gofrs/uuid"
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+)
+
+// uniqueViolation is the postgres error code for unique constraint errors
+const uniqueViolation = "23505"
+
+type postgresUserRepository struct {
+	db *contextDBs
+}
+
+// NewPostgresUserRepository returns a UserRepository backed by postgres.
+func NewPostgresUserRepository(db *gorm.DB) UserRepository {
+	return &postgresUserRepository{db: newContextDBs(db)}
+}
+
+func (r *postgresUserRepository) CreateUser(ctx context.Context, user *User) error {
+	db, done := r.db.withContext(ctx)
+	defer done()
+	return createUser(db, user)
+}
+
+func (r *postgresUserRepository) CreateUsers(ctx context.Context, users []*User, partial bool) ([]error, error) {
+	errs := make([]error, len(users))
+	db, done := r.db.withContext(ctx)
+	defer done()
+	err := bulkTransaction(db, len(users), partial, errs, func(tx *gorm.DB, i int) error {
+		return createUser(tx, users[i])
+	})
+	return errs, err
+}
+
+func (r *postgresUserRepository) DeleteUser(ctx context.Context, id uuid.UUID) (*User, error) {
+	db, done := r.db.withContext(ctx)
+	defer done()
+	return deleteUser(db, id)
+}
+
+func (r *postgresUserRepository) DeleteUsers(ctx context.Context, ids []uuid.UUID, partial bool) ([]*User, []error, error) {
+	users := make([]*User, len(ids))
+	errs := make([]error, len(ids))
+	db, done := r.db.withContext(ctx)
+	defer done()
+	err := bulkTransaction(db, len(ids), partial, errs, func(tx *gorm.DB, i int) error {
+		user, err := deleteUser(tx, ids[i])
+		users[i] = user
+		return err
+	})
+	return users, errs, err
+}
+
+func createUser(db *gorm.DB, user *User) error {
+	if err := setUserDefaults(user); err != nil {
+		return err
+	}
+	err := db.Create(user).Error
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == uniqueViolation {
+		return ErrEmailTaken
+	}
+	return err
+}
+
+func getUser(db *gorm.DB, id uuid.UUID) (*User, error) {
+	var user User
+	err := db.Where("id = ?", id).First(&user).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func deleteUser(db *gorm.DB, id uuid.UUID) (*User, error) {
+	user, err := getUser(db, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Delete(user).Error; err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// bulkTransaction runs fn for each of the n items in one transaction. Each
+// item runs inside its own savepoint so a failing item does not abort the
+// transaction, its error is stored in errs instead. The transaction is
+// rolled back when an item failed, unless partial is set.
+func bulkTransaction(db *gorm.DB, n int, partial bool, errs []error, fn func(tx *gorm.DB, i int) error) error {
+	tx := db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	for i := 0; i < n; i++ {
+		if err := tx.Exec("SAVEPOINT bulk_item").Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		errs[i] = fn(tx, i)
+		release := "RELEASE SAVEPOINT bulk_item"
+		if errs[i] != nil {
+			release = "ROLLBACK TO SAVEPOINT bulk_item"
+		}
+		if err := tx.Exec(release).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if !partial && hasErrors(errs) {
+		return tx.Rollback().Error
+	}
+	return tx.Commit().Error
+}
+
+func (r *postgresUserRepository) GetUser(ctx context.Context, id uuid.UUID) (*User, error) {
+	db, done := r.db.withContext(ctx)
+	defer done()
+	return getUser(db, id)
+}
+
+func (r *postgresUserRepository) FindUserByEmail(ctx context.Context, email string) (*User, error) {
+	var user User
+	db, done := r.db.withContext(ctx)
+	defer done()
+	err := db.Where("lower(email) = lower(?)", email).First(&user).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *postgresUserRepository) FindUserByOIDCSubject(ctx context.Context, subject string) (*User, error) {
+	var user User
+	db, done := r.db.withContext(ctx)
+	defer done()
+	err := db.Where("oidc_subject = ? AND oidc_subject <> ''", subject).First(&user).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *postgresUserRepository) UpdateUser(ctx context.Context, user *User) error {
+	if user.RecoveryCodes == nil {
+		user.RecoveryCodes = pq.StringArray{}
+	}
+	db, done := r.db.withContext(ctx)
+	defer done()
+	res := db.Model(user).Updates(map[string]interface{}{
+		"name":              user.Name,
+		"email":             user.Email,
+		"email_verified_at": user.EmailVerifiedAt,
+		"oidc_subject":      user.OIDCSubject,
+		"password_hash":     user.PasswordHash,
+		"roles":             user.Roles,
+		"totp_secret":       user.TOTPSecret,
+		"totp_enabled":      user.TOTPEnabled,
+		"totp_last_step":    user.TOTPLastStep,
+		"recovery_codes":    user.RecoveryCodes,
+	})
+	if pqErr, ok := res.Error.(*pq.Error); ok && pqErr.Code == uniqueViolation {
+		return ErrEmailTaken
+	}
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func (r *postgresUserRepository) UseTOTPStep(ctx context.Context, id uuid.UUID, step int64) (bool, error) {
+	db, done := r.db.withContext(ctx)
+	defer done()
+	res := db.Model(&User{}).
+		Where("id = ? AND totp_last_step < ?", id, step).
+		Update("totp_last_step", step)
+	return res.RowsAffected > 0, res.Error
+}
+
+func (r *postgresUserRepository) UseRecoveryCode(ctx context.Context, id uuid.UUID, hash string) (bool, error) {
+	db, done := r.db.withContext(ctx)
+	defer done()
+	res := db.Model(&User{}).
+		Where("id = ? AND ? = ANY(recovery_codes)", id, hash).
+		Update("recovery_codes", gorm.Expr("array_remove(recovery_codes, ?)", hash))
+	return res.RowsAffected > 0, res.Error
+}
+
+func (r *postgresUserRepository) ListUsers(ctx context.Context) ([]*User, error) {
+	var users []*User
+	db, done := r.db.withContext(ctx)
+	defer done()
+	if err := db.Order("created_at").Find(&users).Error; err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+type userSearchRow struct {
+	User
+	Rank      float64
+	Highlight string
+}
+
+func (r *postgresUserRepository) SearchUsers(ctx context.Context, query string, limit, offset int) ([]*UserSearchResult, error) {
+	tsQuery := postgresPrefixQuery(query)
+	if tsQuery == "" {
+		return nil, nil
+	}
+
+	var rows []userSearchRow
+	db, done := r.db.withContext(ctx)
+	defer done()
+	err := db.Raw(`
+		SELECT users.*,
+			ts_rank(users.search_vector, q) AS rank,
+			ts_headline('pg_catalog.simple', users.name, q, ?) AS highlight
+		FROM users, to_tsquery('pg_catalog.simple', ?) q
+		WHERE users.deleted_at IS NULL AND users.search_vector @@ q
+		ORDER BY rank DESC, users.id
+		LIMIT ? OFFSET ?`,
+		"StartSel="+HighlightStart+", StopSel="+HighlightStop+", HighlightAll=true",
+		tsQuery, limit, offset,
+	).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*UserSearchResult, len(rows))
+	for i := range rows {
+		user := rows[i].User
+		results[i] = &UserSearchResult{
+			User:      &user,
+			Rank:      rows[i].Rank,
+			Highlight: rows[i].Highlight,
+		}
+	}
+	return results, nil
+}
+
+// postgresPrefixQuery builds a tsquery that requires every term of the
+// query, allowing the last characters of each to still be typed.
+func postgresPrefixQuery(query string) string {
+	tokens := searchTokens(query)
+	for i, t := range tokens {
+		tokens[i] = t + ":*"
+	}
+	return strings.Join(tokens, " & ")
+}
@@ -0,0 +1,106 @@
+package model
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/jinzhu/gorm"
+	"github.com/mattes/migrate"
+	_ "github.com/mattes/migrate/database/postgres" // driver
+	_ "github.com/mattes/migrate/source/file"
+)
+
+// testDatabaseURLEnv names the database the postgres tests run against.
+// They migrate it and leave their rows behind, so it must be a throwaway
+// one; the tests are skipped when it is not set.
+const testDatabaseURLEnv = "GQL_TEST_DATABASE_URL"
+
+func openTestDatabase(t *testing.T) *gorm.DB {
+	url := os.Getenv(testDatabaseURLEnv)
+	if url == "" {
+		t.Skipf("%s is not set", testDatabaseURLEnv)
+	}
+
+	m, err := migrate.New("file://../../migrations", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
+		t.Fatal(err)
+	}
+	m.Close()
+
+	db, err := gorm.Open("postgres", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// uniqueID returns a value no other run of the tests used, for the
+// columns that must be unique as the rows are left behind.
+func uniqueID(t *testing.T) string {
+	id, err := uuid.NewV4()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id.String()
+}
+
+func TestPostgresUserRepositoryDisableTotp(t *testing.T) {
+	db := openTestDatabase(t)
+	defer db.Close()
+	repo := NewPostgresUserRepository(db)
+	ctx := context.Background()
+
+	user := &User{
+		Name:          "a",
+		Email:         uniqueID(t) + "@example.com",
+		TOTPSecret:    "secret",
+		TOTPEnabled:   true,
+		RecoveryCodes: []string{"code"},
+	}
+	if err := repo.CreateUser(ctx, user); err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+
+	// disabling clears the recovery codes, which the column does not
+	// accept as NULL
+	user.TOTPSecret = ""
+	user.TOTPEnabled = false
+	user.RecoveryCodes = nil
+	if err := repo.UpdateUser(ctx, user); err != nil {
+		t.Fatalf("UpdateUser() error = %v", err)
+	}
+
+	got, err := repo.GetUser(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("GetUser() error = %v", err)
+	}
+	if got.TOTPEnabled || got.TOTPSecret != "" || len(got.RecoveryCodes) != 0 {
+		t.Errorf("stored user = %+v, want TOTP disabled", got)
+	}
+}
+
+func TestPostgresUserRepositoryFindUserByOIDCSubject(t *testing.T) {
+	db := openTestDatabase(t)
+	defer db.Close()
+	repo := NewPostgresUserRepository(db)
+	ctx := context.Background()
+
+	subject := uniqueID(t)
+	user := &User{Name: "a", Email: uniqueID(t) + "@example.com", OIDCSubject: subject}
+	if err := repo.CreateUser(ctx, user); err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+
+	got, err := repo.FindUserByOIDCSubject(ctx, subject)
+	if err != nil {
+		t.Fatalf("FindUserByOIDCSubject() error = %v", err)
+	}
+	if got.ID != user.ID {
+		t.Errorf("FindUserByOIDCSubject() = %v, want %v", got.ID, user.ID)
+	}
+}
@@ -0,0 +1,133 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"unicode"
+
+	"github.com/gofrs/uuid"
+	"github.com/lib/pq"
+)
+
+var (
+	// ErrEmailTaken is returned when creating a user with an email that
+	// already belongs to another user.
+	ErrEmailTaken = errors.New("email is already taken")
+
+	// ErrUserNotFound is returned when a user does not exist or was
+	// already deleted.
+	ErrUserNotFound = errors.New("user not found")
+)
+
+// defaultUserRole is the role given to new users
+const defaultUserRole = "USER"
+
+// UserRepository is the storage used to persist and look up users.
+type UserRepository interface {
+	// CreateUser stores a new user, assigning its ID and timestamps when
+	// they are not already set.
+	CreateUser(ctx context.Context, user *User) error
+
+	// CreateUsers stores the users in a single transaction. Unless partial
+	// is set nothing is stored when any of the users fails. The returned
+	// errors line up with the users, with nil for the ones that succeeded.
+	CreateUsers(ctx context.Context, users []*User, partial bool) ([]error, error)
+
+	// DeleteUser deletes the user, returning it as it was before deletion.
+	DeleteUser(ctx context.Context, id uuid.UUID) (*User, error)
+
+	// DeleteUsers deletes the users in a single transaction, following the
+	// same rules as CreateUsers. The deleted users are returned in the
+	// same position as their IDs.
+	DeleteUsers(ctx context.Context, ids []uuid.UUID, partial bool) ([]*User, []error, error)
+
+	// GetUser returns the user with the given ID, or ErrUserNotFound.
+	GetUser(ctx context.Context, id uuid.UUID) (*User, error)
+
+	// FindUserByEmail returns the user with the email, compared without
+	// case, or ErrUserNotFound.
+	FindUserByEmail(ctx context.Context, email string) (*User, error)
+
+	// FindUserByOIDCSubject returns the user linked to the OpenID Connect
+	// subject, or ErrUserNotFound.
+	FindUserByOIDCSubject(ctx context.Context, subject string) (*User, error)
+
+	// UpdateUser saves the changes made to the user, or returns
+	// ErrUserNotFound.
+	UpdateUser(ctx context.Context, user *User) error
+
+	// UseTOTPStep records the time step of an accepted TOTP code, it
+	// reports false when a code of that or a later step was already used.
+	UseTOTPStep(ctx context.Context, id uuid.UUID, step int64) (bool, error)
+
+	// UseRecoveryCode removes the recovery code with the hash from the
+	// user, it reports false when the user has no such code.
+	UseRecoveryCode(ctx context.Context, id uuid.UUID, hash string) (bool, error)
+
+	// ListUsers returns every user that has not been deleted.
+	ListUsers(ctx context.Context) ([]*User, error)
+
+	// SearchUsers runs a full-text search over the users, returning up to
+	// limit results ordered by rank, skipping the first offset matches.
+	SearchUsers(ctx context.Context, query string, limit, offset int) ([]*UserSearchResult, error)
+}
+
+// UserSearchResult is a single ranked match returned by SearchUsers.
+type UserSearchResult struct {
+	User *User
+
+	// Rank how well the user matched the query, higher is better
+	Rank float64
+
+	// Highlight the matched text with the matching terms wrapped in
+	// HighlightStart and HighlightStop
+	Highlight string
+}
+
+const (
+	// HighlightStart marks the beginning of a matched term in a highlight
+	HighlightStart = "<b>"
+
+	// HighlightStop marks the end of a matched term in a highlight
+	HighlightStop = "</b>"
+)
+
+// hasErrors reports whether any of the per item errors is set.
+func hasErrors(errs []error) bool {
+	for _, err := range errs {
+		if err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// setUserDefaults gives the user a new ID if it does not have one yet, and
+// the user role when it has no roles.
+func setUserDefaults(user *User) error {
+	if len(user.Roles) == 0 {
+		user.Roles = []string{defaultUserRole}
+	}
+	if user.RecoveryCodes == nil {
+		// a nil array is written as NULL, the column does not take it
+		user.RecoveryCodes = pq.StringArray{}
+	}
+	if user.ID != uuid.Nil {
+		return nil
+	}
+	id, err := uuid.NewV4()
+	if err != nil {
+		return err
+	}
+	user.ID = id
+	return nil
+}
+
+// searchTokens splits a search query into lower-cased terms, dropping any
+// character that is not a letter or a digit.
+func searchTokens(query string) []string {
+	return strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
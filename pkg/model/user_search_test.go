@@ -0,0 +1,74 @@
+package model
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPostgresPrefixQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"", ""},
+		{"  ,. ", ""},
+		{"ada", "ada:*"},
+		{"Ada LOVE", "ada:* & love:*"},
+		{"o'brien", "o:* & brien:*"},
+		{"ada & !x | (y)", "ada:* & x:* & y:*"},
+	}
+	for _, tt := range tests {
+		if got := postgresPrefixQuery(tt.query); got != tt.want {
+			t.Errorf("postgresPrefixQuery(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestMemoryUserRepositorySearchUsers(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryUserRepository()
+	deletedAt := time.Now()
+	for _, u := range []*User{
+		{Name: "Ada Lovelace"},
+		{Name: "Ada"},
+		{Name: "Grace Hopper"},
+		{Name: "Ada Deleted", DeletedAt: &deletedAt},
+	} {
+		if err := repo.CreateUser(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results, err := repo.SearchUsers(ctx, "ada", 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("got %d results, want 2", len(results))
+	}
+	// the name matched in full ranks first
+	if results[0].User.Name != "Ada" || results[0].Rank != 1 || results[0].Highlight != "<b>Ada</b>" {
+		t.Errorf("first result = %+v", results[0])
+	}
+	if results[1].User.Name != "Ada Lovelace" || results[1].Rank != 0.5 || results[1].Highlight != "<b>Ada</b> Lovelace" {
+		t.Errorf("second result = %+v", results[1])
+	}
+
+	results, err = repo.SearchUsers(ctx, "ada", 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].User.Name != "Ada Lovelace" {
+		t.Errorf("SearchUsers() with limit 1 and offset 1 = %+v, want Ada Lovelace", results)
+	}
+
+	// every term has to match a word
+	results, err = repo.SearchUsers(ctx, "ada hop", 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 0 {
+		t.Errorf("SearchUsers(%q) = %d results, want none", "ada hop", len(results))
+	}
+}
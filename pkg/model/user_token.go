@@ -0,0 +1,68 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// ErrUserTokenInvalid is returned when a token does not exist, was already
+// used or expired.
+var ErrUserTokenInvalid = errors.New("token is invalid or expired")
+
+// UserTokenPurpose is what a user token can be used for.
+type UserTokenPurpose string
+
+const (
+	// UserTokenVerifyEmail tokens confirm the user owns their email
+	UserTokenVerifyEmail UserTokenPurpose = "verify_email"
+
+	// UserTokenResetPassword tokens set a new password for the user
+	UserTokenResetPassword UserTokenPurpose = "reset_password"
+)
+
+// UserToken is a single use token mailed to a user, of which only the hash
+// is stored.
+type UserToken struct {
+	// ID the unique ID for the token
+	ID uuid.UUID
+
+	// UserID the ID of the user the token was sent to
+	UserID uuid.UUID
+
+	// Purpose what the token can be used for
+	Purpose UserTokenPurpose
+
+	// Email the address the token was sent to, so a token cannot verify an
+	// email the user changed to afterwards
+	Email string
+
+	// TokenHash the hash of the token
+	TokenHash string
+
+	// CreatedAt the date the token was created
+	CreatedAt time.Time
+
+	// ExpiresAt the date after which the token is no longer valid
+	ExpiresAt time.Time
+
+	// UsedAt the date the token was used
+	UsedAt *time.Time
+}
+
+// UserTokenRepository is the storage used for user tokens.
+type UserTokenRepository interface {
+	// CreateUserToken stores a new token, assigning its ID when not set.
+	CreateUserToken(ctx context.Context, token *UserToken) error
+
+	// UseUserToken marks the token with the purpose and hash as used,
+	// returning it. It returns ErrUserTokenInvalid when there is no such
+	// token, or it was already used or expired.
+	UseUserToken(ctx context.Context, purpose UserTokenPurpose, tokenHash string) (*UserToken, error)
+
+	// RevokeUserTokens marks every unused token of the user with the
+	// purpose as used, so the ones still in the user's inbox stop working.
+	RevokeUserTokens(ctx context.Context, userID uuid.UUID, purpose UserTokenPurpose) error
+}
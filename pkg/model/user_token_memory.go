@@ -0,0 +1,71 @@
+package model
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+type memoryUserTokenRepository struct {
+	mu     sync.Mutex
+	tokens []*UserToken
+}
+
+// NewMemoryUserTokenRepository returns a UserTokenRepository that keeps
+// the tokens in memory.
+func NewMemoryUserTokenRepository() UserTokenRepository {
+	return &memoryUserTokenRepository{}
+}
+
+func (r *memoryUserTokenRepository) CreateUserToken(ctx context.Context, token *UserToken) error {
+	if token.ID == uuid.Nil {
+		id, err := uuid.NewV4()
+		if err != nil {
+			return err
+		}
+		token.ID = id
+	}
+	if token.CreatedAt.IsZero() {
+		token.CreatedAt = time.Now()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored := *token
+	r.tokens = append(r.tokens, &stored)
+	return nil
+}
+
+func (r *memoryUserTokenRepository) UseUserToken(ctx context.Context, purpose UserTokenPurpose, tokenHash string) (*UserToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for _, t := range r.tokens {
+		if t.Purpose != purpose || t.TokenHash != tokenHash {
+			continue
+		}
+		if t.UsedAt != nil || !now.Before(t.ExpiresAt) {
+			return nil, ErrUserTokenInvalid
+		}
+		t.UsedAt = &now
+		token := *t
+		return &token, nil
+	}
+	return nil, ErrUserTokenInvalid
+}
+
+func (r *memoryUserTokenRepository) RevokeUserTokens(ctx context.Context, userID uuid.UUID, purpose UserTokenPurpose) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for _, t := range r.tokens {
+		if t.UserID == userID && t.Purpose == purpose && t.UsedAt == nil {
+			t.UsedAt = &now
+		}
+	}
+	return nil
+}
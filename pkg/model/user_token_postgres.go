@@ -0,0 +1,60 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jinzhu/gorm"
+)
+
+type postgresUserTokenRepository struct {
+	db *contextDBs
+}
+
+// NewPostgresUserTokenRepository returns a UserTokenRepository backed by
+// postgres.
+func NewPostgresUserTokenRepository(db *gorm.DB) UserTokenRepository {
+	return &postgresUserTokenRepository{db: newContextDBs(db)}
+}
+
+func (r *postgresUserTokenRepository) CreateUserToken(ctx context.Context, token *UserToken) error {
+	if token.ID == uuid.Nil {
+		id, err := uuid.NewV4()
+		if err != nil {
+			return err
+		}
+		token.ID = id
+	}
+	db, done := r.db.withContext(ctx)
+	defer done()
+	return db.Create(token).Error
+}
+
+func (r *postgresUserTokenRepository) UseUserToken(ctx context.Context, purpose UserTokenPurpose, tokenHash string) (*UserToken, error) {
+	// the token is marked used and returned in one statement, so it cannot
+	// be used twice by concurrent requests
+	var tokens []*UserToken
+	now := time.Now()
+	db, done := r.db.withContext(ctx)
+	defer done()
+	err := db.Raw(`
+		UPDATE user_tokens SET used_at = ?
+		WHERE purpose = ? AND token_hash = ? AND used_at IS NULL AND expires_at > ?
+		RETURNING *`, now, purpose, tokenHash, now).Scan(&tokens).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, ErrUserTokenInvalid
+	}
+	return tokens[0], nil
+}
+
+func (r *postgresUserTokenRepository) RevokeUserTokens(ctx context.Context, userID uuid.UUID, purpose UserTokenPurpose) error {
+	db, done := r.db.withContext(ctx)
+	defer done()
+	return db.Exec(`
+		UPDATE user_tokens SET used_at = ?
+		WHERE user_id = ? AND purpose = ? AND used_at IS NULL`, time.Now(), userID, purpose).Error
+}
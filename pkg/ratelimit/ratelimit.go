@@ -0,0 +1,114 @@
+// Package ratelimit limits how often clients can make requests, using a
+// token bucket per client.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit is the size and refill rate of a bucket.
+type Limit struct {
+	// Rate the tokens added to the bucket every second
+	Rate float64
+
+	// Burst the most tokens the bucket holds, a client that has been idle
+	// can spend all of them at once
+	Burst int
+}
+
+// Result is the outcome of taking tokens from a bucket.
+type Result struct {
+	// Allowed whether the tokens were taken
+	Allowed bool
+
+	// Limit the burst of the bucket
+	Limit int
+
+	// Remaining the whole tokens left in the bucket
+	Remaining int
+
+	// Reset how long until the bucket is full again
+	Reset time.Duration
+
+	// RetryAfter how long until the tokens asked for are available, zero
+	// when they were taken
+	RetryAfter time.Duration
+}
+
+// Limiter keeps a token bucket per key. The zero value is ready to use.
+type Limiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	limit  Limit
+	tokens float64
+	last   time.Time
+}
+
+// Take takes cost tokens from the bucket of the key, creating a full one
+// with the limit when the key has none. A cost above the burst is charged
+// the burst, otherwise the request could never be allowed.
+func (l *Limiter) Take(key string, limit Limit, cost int, now time.Time) Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.buckets == nil {
+		l.buckets = map[string]*bucket{}
+	}
+	b, ok := l.buckets[key]
+	if !ok || b.limit != limit {
+		b = &bucket{limit: limit, tokens: float64(limit.Burst), last: now}
+		l.buckets[key] = b
+	}
+	b.refill(now)
+
+	if cost > limit.Burst {
+		cost = limit.Burst
+	}
+	res := Result{Limit: limit.Burst}
+	if b.tokens >= float64(cost) {
+		b.tokens -= float64(cost)
+		res.Allowed = true
+	} else {
+		res.RetryAfter = b.wait(float64(cost) - b.tokens)
+	}
+	res.Remaining = int(math.Floor(b.tokens))
+	res.Reset = b.wait(float64(limit.Burst) - b.tokens)
+	return res
+}
+
+// Prune forgets the buckets that have refilled, a new full bucket being
+// the same as those.
+func (l *Limiter) Prune(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for key, b := range l.buckets {
+		b.refill(now)
+		if b.tokens >= float64(b.limit.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+func (b *bucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(float64(b.limit.Burst), b.tokens+elapsed.Seconds()*b.limit.Rate)
+		b.last = now
+	}
+}
+
+// wait returns how long the bucket takes to gain the tokens.
+func (b *bucket) wait(tokens float64) time.Duration {
+	if tokens <= 0 {
+		return 0
+	}
+	if b.limit.Rate <= 0 {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration(tokens / b.limit.Rate * float64(time.Second))
+}
@@ -0,0 +1,81 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiterTake(t *testing.T) {
+	limit := Limit{Rate: 1, Burst: 3}
+	start := time.Unix(1000, 0)
+
+	type take struct {
+		key  string
+		cost int
+		at   time.Duration
+		want Result
+	}
+	tests := []struct {
+		name  string
+		takes []take
+	}{
+		{
+			name: "burst then limited",
+			takes: []take{
+				{"a", 1, 0, Result{Allowed: true, Limit: 3, Remaining: 2, Reset: time.Second}},
+				{"a", 1, 0, Result{Allowed: true, Limit: 3, Remaining: 1, Reset: 2 * time.Second}},
+				{"a", 1, 0, Result{Allowed: true, Limit: 3, Remaining: 0, Reset: 3 * time.Second}},
+				{"a", 1, 0, Result{Allowed: false, Limit: 3, Remaining: 0, Reset: 3 * time.Second, RetryAfter: time.Second}},
+			},
+		},
+		{
+			name: "refills with time",
+			takes: []take{
+				{"a", 3, 0, Result{Allowed: true, Limit: 3, Remaining: 0, Reset: 3 * time.Second}},
+				{"a", 1, 500 * time.Millisecond, Result{Allowed: false, Limit: 3, Remaining: 0, Reset: 2500 * time.Millisecond, RetryAfter: 500 * time.Millisecond}},
+				{"a", 1, time.Second, Result{Allowed: true, Limit: 3, Remaining: 0, Reset: 3 * time.Second}},
+			},
+		},
+		{
+			name: "keys have their own bucket",
+			takes: []take{
+				{"a", 3, 0, Result{Allowed: true, Limit: 3, Remaining: 0, Reset: 3 * time.Second}},
+				{"b", 1, 0, Result{Allowed: true, Limit: 3, Remaining: 2, Reset: time.Second}},
+			},
+		},
+		{
+			name: "cost above the burst is charged the burst",
+			takes: []take{
+				{"a", 10, 0, Result{Allowed: true, Limit: 3, Remaining: 0, Reset: 3 * time.Second}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var l Limiter
+			for i, take := range tt.takes {
+				got := l.Take(take.key, limit, take.cost, start.Add(take.at))
+				if got != take.want {
+					t.Errorf("take %d: Take() = %+v, want %+v", i, got, take.want)
+				}
+			}
+		})
+	}
+}
+
+func TestLimiterPrune(t *testing.T) {
+	limit := Limit{Rate: 1, Burst: 2}
+	start := time.Unix(1000, 0)
+
+	var l Limiter
+	l.Take("full", limit, 1, start)
+	l.Take("empty", limit, 2, start.Add(time.Second))
+	l.Prune(start.Add(1500 * time.Millisecond))
+
+	if _, ok := l.buckets["full"]; ok {
+		t.Error("bucket that refilled was kept")
+	}
+	if _, ok := l.buckets["empty"]; !ok {
+		t.Error("bucket still refilling was pruned")
+	}
+}
@@ -0,0 +1,242 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/caquillo07/graphql-server-demo/conf"
+	"github.com/caquillo07/graphql-server-demo/pkg/auth"
+	"github.com/caquillo07/graphql-server-demo/pkg/mail"
+	"github.com/caquillo07/graphql-server-demo/pkg/model"
+	"github.com/caquillo07/graphql-server-demo/pkg/ratelimit"
+)
+
+// accountEmailLimit is how many password resets can be sent to an
+// address, and how many email verifications a user can ask for, 3 at once
+// then one every 20 minutes.
+var accountEmailLimit = ratelimit.Limit{Rate: 1.0 / (20 * 60), Burst: 3}
+
+var (
+	errInvalidUserToken     = &codedError{code: "INVALID_TOKEN", message: "token is invalid or expired"}
+	errEmailAlreadyVerified = &codedError{code: "EMAIL_ALREADY_VERIFIED", message: "email is already verified"}
+	errMailDisabled         = &codedError{code: "MAIL_DISABLED", message: "emails are not sent by this server"}
+)
+
+// newMailer returns the mailer selected by the mail driver, nil when none
+// is set.
+func newMailer(config conf.Config) (mail.Mailer, error) {
+	switch config.Mail.Driver {
+	case "smtp":
+		return &mail.SMTPMailer{
+			Host:     config.Mail.SMTP.Host,
+			Port:     config.Mail.SMTP.Port,
+			Username: config.Mail.SMTP.Username,
+			Password: config.Mail.SMTP.Password,
+			From:     config.Mail.From,
+		}, nil
+	case "log":
+		zap.L().Warn("emails are written out by the log driver, do not use it in production")
+		return &mail.LogMailer{Path: config.Mail.LogFile, From: config.Mail.From}, nil
+	case "":
+		zap.L().Info("mail.driver is not set, email verification and password resets are disabled")
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q", config.Mail.Driver)
+	}
+}
+
+func (s *server) RequestEmailVerification(ctx context.Context) (bool, error) {
+	if s.mailer == nil {
+		return false, errMailDisabled
+	}
+	user, err := s.currentUser(ctx)
+	if err != nil {
+		return false, err
+	}
+	if user.EmailVerifiedAt != nil {
+		return false, errEmailAlreadyVerified
+	}
+	if res := s.rateLimiter.Take("verify:"+user.ID.String(), accountEmailLimit, 1, time.Now()); !res.Allowed {
+		return false, errRateLimited
+	}
+	if err := s.sendEmailVerification(ctx, user); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *server) VerifyEmail(ctx context.Context, token string) (bool, error) {
+	userToken, err := s.userTokens.UseUserToken(ctx, model.UserTokenVerifyEmail, auth.HashSessionToken(token))
+	if err == model.ErrUserTokenInvalid {
+		return false, errInvalidUserToken
+	}
+	if err != nil {
+		return false, err
+	}
+
+	user, err := s.users.GetUser(ctx, userToken.UserID)
+	if err == model.ErrUserNotFound {
+		return false, errInvalidUserToken
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// the token only proves the user owns the email it was sent to
+	if !strings.EqualFold(user.Email, userToken.Email) {
+		return false, errInvalidUserToken
+	}
+	if user.EmailVerifiedAt == nil {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+		if err := s.users.UpdateUser(ctx, user); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func (s *server) RequestPasswordReset(ctx context.Context, email string) (bool, error) {
+	if s.mailer == nil {
+		return false, errMailDisabled
+	}
+
+	// the requests for an address past its limit are dropped without
+	// telling, the response is the same whether or not a user has it
+	email = strings.TrimSpace(email)
+	res := s.rateLimiter.Take("reset:"+strings.ToLower(email), accountEmailLimit, 1, time.Now())
+	if !res.Allowed {
+		logger(ctx).Warn("dropped password reset request over the limit of the address")
+		return true, nil
+	}
+
+	// the reset is sent in the background so the response takes as long
+	// whether or not a user has the email
+	log := logger(ctx)
+	go func() {
+		ctx := context.Background()
+		user, err := s.users.FindUserByEmail(ctx, email)
+		if err == model.ErrUserNotFound {
+			return
+		}
+		if err == nil {
+			err = s.sendPasswordReset(ctx, user)
+		}
+		if err != nil {
+			log.Error("failed to send password reset", zap.Error(err))
+		}
+	}()
+	return true, nil
+}
+
+func (s *server) ResetPassword(ctx context.Context, token string, newPassword string) (bool, error) {
+	// the password is checked first so a weak one does not use the token up
+	if err := validatePassword(newPassword); err != nil {
+		return false, err
+	}
+
+	userToken, err := s.userTokens.UseUserToken(ctx, model.UserTokenResetPassword, auth.HashSessionToken(token))
+	if err == model.ErrUserTokenInvalid {
+		return false, errInvalidUserToken
+	}
+	if err != nil {
+		return false, err
+	}
+	user, err := s.users.GetUser(ctx, userToken.UserID)
+	if err == model.ErrUserNotFound {
+		return false, errInvalidUserToken
+	}
+	if err != nil {
+		return false, err
+	}
+	if !strings.EqualFold(user.Email, userToken.Email) {
+		return false, errInvalidUserToken
+	}
+
+	hash, err := auth.HashPassword(newPassword)
+	if err != nil {
+		return false, err
+	}
+	user.PasswordHash = hash
+
+	// receiving the reset link proves the user owns the email as well
+	if user.EmailVerifiedAt == nil {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+	}
+	if err := s.users.UpdateUser(ctx, user); err != nil {
+		return false, err
+	}
+
+	// whoever knew the old password must not stay logged in, nor use
+	// another reset link sent before
+	if err := s.userTokens.RevokeUserTokens(ctx, user.ID, model.UserTokenResetPassword); err != nil {
+		return false, err
+	}
+	ids, err := s.sessions.RevokeUserSessions(ctx, user.ID)
+	if err != nil {
+		return false, err
+	}
+	for _, id := range ids {
+		s.sessionConns.close(id.String())
+	}
+	s.loginThrottle.Unlock(loginAccount(user.Email))
+	return true, nil
+}
+
+func (s *server) sendEmailVerification(ctx context.Context, user *model.User) error {
+	token, err := s.createUserToken(ctx, user, model.UserTokenVerifyEmail, s.config.Auth.EmailVerificationTTL)
+	if err != nil {
+		return err
+	}
+	return s.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Verify your email",
+		Body: fmt.Sprintf("Hi %s,\n\nOpen the link below to verify your email:\n\n%s\n\nThe link expires in %s.\n",
+			user.Name, s.mailLink("/verify-email", token), s.config.Auth.EmailVerificationTTL),
+	})
+}
+
+func (s *server) sendPasswordReset(ctx context.Context, user *model.User) error {
+	token, err := s.createUserToken(ctx, user, model.UserTokenResetPassword, s.config.Auth.PasswordResetTTL)
+	if err != nil {
+		return err
+	}
+	return s.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nOpen the link below to choose a new password:\n\n%s\n\n"+
+			"The link expires in %s. If you did not ask to reset your password you can ignore this email.\n",
+			user.Name, s.mailLink("/reset-password", token), s.config.Auth.PasswordResetTTL),
+	})
+}
+
+// createUserToken stores a new token for the user, returning the token to
+// mail them.
+func (s *server) createUserToken(ctx context.Context, user *model.User, purpose model.UserTokenPurpose, ttl time.Duration) (string, error) {
+	token, hash, err := auth.GenerateSessionToken()
+	if err != nil {
+		return "", err
+	}
+	err = s.userTokens.CreateUserToken(ctx, &model.UserToken{
+		UserID:    user.ID,
+		Purpose:   purpose,
+		Email:     user.Email,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// mailLink returns the link to the frontend page that receives the token.
+func (s *server) mailLink(path, token string) string {
+	return strings.TrimSuffix(s.config.Mail.LinkBaseURL, "/") + path + "?token=" + url.QueryEscape(token)
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"context"
+	"net/url"
+	"regexp"
+	"sync"
+	"testing"
+
+	"github.com/caquillo07/graphql-server-demo/pkg/auth"
+	"github.com/caquillo07/graphql-server-demo/pkg/mail"
+	"github.com/caquillo07/graphql-server-demo/pkg/model"
+)
+
+// sentMails keeps the messages instead of sending them.
+type sentMails struct {
+	mu       sync.Mutex
+	messages []mail.Message
+}
+
+func (m *sentMails) Send(ctx context.Context, msg mail.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+var mailTokenPattern = regexp.MustCompile(`token=(\S+)`)
+
+// lastToken returns the token in the link of the last message sent.
+func (m *sentMails) lastToken(t *testing.T) string {
+	t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.messages) == 0 {
+		t.Fatal("no email was sent")
+	}
+	match := mailTokenPattern.FindStringSubmatch(m.messages[len(m.messages)-1].Body)
+	if match == nil {
+		t.Fatal("the email has no link")
+	}
+	token, err := url.QueryUnescape(match[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestResetPasswordRevokesOtherLinksAndSessions(t *testing.T) {
+	s := newTestServer(t, testConfig())
+	mails := &sentMails{}
+	s.mailer = mails
+
+	ctx := context.Background()
+	user := &model.User{Name: "User", Email: "user@example.com"}
+	if err := s.users.CreateUser(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	session, err := s.startSession(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.sendPasswordReset(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	earlier := mails.lastToken(t)
+	if err := s.sendPasswordReset(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.ResetPassword(ctx, mails.lastToken(t), "correct horse battery staple"); err != nil {
+		t.Fatalf("ResetPassword() error = %v", err)
+	}
+	if _, err := s.ResetPassword(ctx, earlier, "another password entirely"); err != errInvalidUserToken {
+		t.Errorf("ResetPassword() with an earlier link: error = %v, want %v", err, errInvalidUserToken)
+	}
+	if _, err := s.authenticateSession(ctx, session.Token); err != errInvalidSession {
+		t.Errorf("session from before the reset: error = %v, want %v", err, errInvalidSession)
+	}
+}
+
+func TestRequestEmailVerificationLimit(t *testing.T) {
+	s := newTestServer(t, testConfig())
+	s.mailer = &sentMails{}
+
+	user := &model.User{Name: "User", Email: "user@example.com"}
+	if err := s.users.CreateUser(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	ctx := auth.WithPrincipal(context.Background(), &auth.Principal{Type: auth.PrincipalUser, Subject: user.ID.String()})
+
+	for i := 0; i < accountEmailLimit.Burst; i++ {
+		if _, err := s.RequestEmailVerification(ctx); err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+	}
+	if _, err := s.RequestEmailVerification(ctx); err != errRateLimited {
+		t.Errorf("request past the limit: error = %v, want %v", err, errRateLimited)
+	}
+}
+
+func TestMailDisabledWithoutDriver(t *testing.T) {
+	config := testConfig()
+	config.Mail.Driver = ""
+	s := newTestServer(t, config)
+
+	if _, err := s.RequestPasswordReset(context.Background(), "user@example.com"); err != errMailDisabled {
+		t.Errorf("RequestPasswordReset() error = %v, want %v", err, errMailDisabled)
+	}
+}
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"net/url"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"go.uber.org/zap"
+
+	"github.com/caquillo07/graphql-server-demo/pkg/buildinfo"
+	"github.com/caquillo07/graphql-server-demo/pkg/logging"
+)
+
+// sensitiveConfig are the config fields whose values /debug/config hides,
+// any field ending with one of them regardless of case is redacted.
+var sensitiveConfig = []string{"secret", "password"}
+
+// newAdminServer returns the listener for operators, or nil when no admin
+// port is configured. It has no write timeout, CPU profiles and traces take
+// as long as they are asked to.
+func (s *server) newAdminServer() *http.Server {
+	if s.config.Server.AdminPort == "" {
+		return nil
+	}
+	r := chi.NewRouter()
+	r.Use(withRequestID, accessLog, recoverPanic)
+	r.Handle("/metrics", &s.metrics.registry)
+	r.Get("/readyz", s.readyz(true))
+	r.Get("/version", version)
+	r.Get("/debug/config", s.debugConfig)
+	r.Get("/loglevel", logLevel)
+	r.Put("/loglevel", logLevel)
+
+	r.HandleFunc("/debug/pprof/", pprof.Index)
+	r.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	r.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	r.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	r.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	r.Handle("/debug/pprof/{profile}", http.HandlerFunc(pprof.Index))
+
+	return &http.Server{
+		Addr:           net.JoinHostPort(s.config.Server.AdminHost, s.config.Server.AdminPort),
+		Handler:        r,
+		ReadTimeout:    s.config.Server.ReadTimeout,
+		IdleTimeout:    s.config.Server.IdleTimeout,
+		MaxHeaderBytes: s.config.Server.MaxHeaderBytes,
+	}
+}
+
+func (s *server) serveAdmin() {
+	zap.L().Info("admin listening on http://" + s.adminServer.Addr)
+	if err := s.adminServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		zap.L().Error("admin server failed", zap.Error(err))
+	}
+}
+
+// version responds with what the binary was built from.
+func version(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, buildinfo.Get())
+}
+
+// debugConfig responds with the config the server runs with, secrets and
+// the password of the database URL redacted.
+func (s *server) debugConfig(w http.ResponseWriter, r *http.Request) {
+	config := s.config
+	config.Database.URL = redactURL(config.Database.URL)
+
+	// go through JSON to get the config as maps, which can be redacted
+	b, err := json.Marshal(config)
+	if err != nil {
+		logger(r.Context()).Error("failed to encode config", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "internal server error")
+		return
+	}
+	var values map[string]interface{}
+	if err := json.Unmarshal(b, &values); err != nil {
+		logger(r.Context()).Error("failed to decode config", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "internal server error")
+		return
+	}
+	redactConfig(values)
+	writeJSON(w, values)
+}
+
+// redactConfig replaces the values of the sensitive fields that are set,
+// the ones left empty are kept to show they are not.
+func redactConfig(values map[string]interface{}) {
+	for name, value := range values {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			redactConfig(v)
+		case string:
+			if v != "" && isSensitiveConfig(name) {
+				values[name] = redactedValue
+			}
+		}
+	}
+}
+
+func isSensitiveConfig(name string) bool {
+	name = strings.ToLower(name)
+	for _, s := range sensitiveConfig {
+		if strings.HasSuffix(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactURL hides the password of a URL. Anything else, such as a
+// key=value connection string, is hidden whole as it could hold one.
+func redactURL(rawURL string) string {
+	if rawURL == "" {
+		return ""
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme == "" {
+		return redactedValue
+	}
+	if q := u.Query(); q.Get("password") != "" {
+		q.Set("password", redactedValue)
+		u.RawQuery = q.Encode()
+	}
+	if _, ok := u.User.Password(); !ok {
+		return u.String()
+	}
+	u.User = url.User(u.User.Username())
+	return strings.Replace(u.String(), "@", ":"+redactedValue+"@", 1)
+}
+
+// logLevel reads the level of the global logger on GET, and changes it on
+// PUT with a body like {"level":"debug"}.
+func logLevel(w http.ResponseWriter, r *http.Request) {
+	sw := &statusWriter{ResponseWriter: w, statusCode: http.StatusOK}
+	logging.Level.ServeHTTP(sw, r)
+	if r.Method == http.MethodPut && sw.statusCode == http.StatusOK {
+		logger(r.Context()).Warn("log level changed", zap.Stringer("level", logging.Level.Level()))
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRedactConfig(t *testing.T) {
+	values := map[string]interface{}{
+		"Auth": map[string]interface{}{
+			"HMACSecret":       "s3cret",
+			"PasswordResetTTL": float64(3600),
+			"OIDC": map[string]interface{}{
+				"ClientSecret": "shh",
+				"ClientID":     "client",
+			},
+		},
+		"Mail": map[string]interface{}{
+			"SMTP": map[string]interface{}{
+				"Password": "pw",
+				"Username": "user",
+			},
+		},
+		"Server": map[string]interface{}{
+			"ClientSecret": "",
+		},
+	}
+	want := map[string]interface{}{
+		"Auth": map[string]interface{}{
+			"HMACSecret":       redactedValue,
+			"PasswordResetTTL": float64(3600),
+			"OIDC": map[string]interface{}{
+				"ClientSecret": redactedValue,
+				"ClientID":     "client",
+			},
+		},
+		"Mail": map[string]interface{}{
+			"SMTP": map[string]interface{}{
+				"Password": redactedValue,
+				"Username": "user",
+			},
+		},
+		"Server": map[string]interface{}{
+			// empty values are left to show they are not set
+			"ClientSecret": "",
+		},
+	}
+
+	redactConfig(values)
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("redactConfig() = %v, want %v", values, want)
+	}
+}
+
+func TestRedactURL(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		want string
+	}{
+		{"empty", "", ""},
+		{"no password", "postgres://user@localhost:5432/db", "postgres://user@localhost:5432/db"},
+		{"password", "postgres://user:pw@localhost:5432/db?sslmode=disable", "postgres://user:" + redactedValue + "@localhost:5432/db?sslmode=disable"},
+		{"password in the query", "postgres://localhost/db?password=pw&user=u", "postgres://localhost/db?password=%5BREDACTED%5D&user=u"},
+		{"key value string", "host=localhost user=u password=pw", redactedValue},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redactURL(tt.url); got != tt.want {
+				t.Errorf("redactURL(%q) = %q, want %q", tt.url, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,233 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"go.uber.org/zap"
+
+	"github.com/caquillo07/graphql-server-demo/conf"
+	"github.com/caquillo07/graphql-server-demo/pkg/auth"
+	"github.com/caquillo07/graphql-server-demo/pkg/model"
+)
+
+// newJWTVerifier returns the verifier of bearer tokens, or nil when no
+// signing keys are configured.
+func newJWTVerifier(config conf.Config) (*auth.JWTVerifier, error) {
+	if config.Auth.HMACSecret == "" && config.Auth.JWKSFile == "" {
+		return nil, nil
+	}
+
+	verifier := &auth.JWTVerifier{
+		Issuer:   config.Auth.Issuer,
+		Audience: config.Auth.Audience,
+		Secret:   []byte(config.Auth.HMACSecret),
+		Leeway:   config.Auth.Leeway,
+	}
+	if config.Auth.JWKSFile != "" {
+		keys, err := auth.LoadJWKS(config.Auth.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		verifier.Keys = keys
+	}
+	return verifier, nil
+}
+
+// apiKeyHeader is the header services send their API key in
+const apiKeyHeader = "X-Api-Key"
+
+var (
+	errUnsupportedScheme = errors.New("unsupported authorization scheme")
+	errBearerDisabled    = errors.New("bearer tokens are not accepted")
+	errInvalidAPIKey     = errors.New("invalid api key")
+	errInvalidSession    = errors.New("invalid or expired session")
+)
+
+// authenticate puts the principal of requests with a valid bearer token,
+// API key, session cookie or client certificate in their context. Bearer tokens are either
+// JWTs or session tokens. Requests without credentials carry on
+// anonymously, while requests with invalid credentials are rejected.
+func (s *server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var principal *auth.Principal
+		var err error
+		bearer := false
+		if key := r.Header.Get(apiKeyHeader); key != "" {
+			principal, err = s.authenticateAPIKey(r.Context(), key)
+		} else if header := r.Header.Get("Authorization"); header != "" {
+			principal, err = s.authenticateBearer(r.Context(), header)
+			bearer = true
+		} else if cookie := s.sessionCookie(r); cookie != nil {
+			principal, err = s.authenticateSession(r.Context(), cookie.Value)
+		} else {
+			// the certificate was verified during the TLS handshake
+			principal = clientCertPrincipal(r)
+		}
+
+		// only wrong credentials are charged and reported, failing to check
+		// them, such as the database being down, is not the caller's doing
+		if err != nil && !badCredentials(err) {
+			logger(r.Context()).Error("failed to authenticate request", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "internal server error")
+			return
+		}
+		if err != nil {
+			if bearer {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			}
+			if !s.chargeFailedAuth(w, r) {
+				return
+			}
+			writeError(w, http.StatusUnauthorized, "UNAUTHENTICATED", err.Error())
+			return
+		}
+		if principal == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+	})
+}
+
+// badCredentials reports whether the error is the credentials of the
+// request being wrong, as opposed to them failing to be checked.
+func badCredentials(err error) bool {
+	switch err {
+	case errUnsupportedScheme, errBearerDisabled, errInvalidAPIKey, errInvalidSession, auth.ErrInvalidToken:
+		return true
+	}
+	return false
+}
+
+func (s *server) authenticateBearer(ctx context.Context, header string) (*auth.Principal, error) {
+	const prefix = "bearer "
+	if len(header) <= len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return nil, errUnsupportedScheme
+	}
+	token := header[len(prefix):]
+
+	// session tokens are plain base64, only JWTs have segments
+	if !strings.Contains(token, ".") {
+		return s.authenticateSession(ctx, token)
+	}
+	if s.jwtVerifier == nil {
+		return nil, errBearerDisabled
+	}
+	claims, err := s.jwtVerifier.Verify(token)
+	if err != nil {
+		return nil, err
+	}
+	return claims.Principal(), nil
+}
+
+func (s *server) authenticateSession(ctx context.Context, token string) (*auth.Principal, error) {
+	session, err := s.sessions.FindSessionByTokenHash(ctx, auth.HashSessionToken(token))
+	if err == model.ErrSessionNotFound {
+		return nil, errInvalidSession
+	}
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if !session.Active(now) {
+		return nil, errInvalidSession
+	}
+
+	// the roles are read from the user on every request so changes to them,
+	// or the user being deleted, take effect right away
+	user, err := s.users.GetUser(ctx, session.UserID)
+	if err == model.ErrUserNotFound {
+		return nil, errInvalidSession
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.sessionUsage.record(session.ID, now)
+
+	return &auth.Principal{
+		Type:           auth.PrincipalUser,
+		Subject:        user.ID.String(),
+		Roles:          user.Roles,
+		SessionID:      session.ID.String(),
+		ImpersonatedBy: session.ImpersonatedBy,
+	}, nil
+}
+
+func (s *server) authenticateAPIKey(ctx context.Context, key string) (*auth.Principal, error) {
+	prefix, secret, ok := auth.ParseAPIKey(key)
+	if !ok {
+		return nil, errInvalidAPIKey
+	}
+
+	apiKey, err := s.apiKeys.FindAPIKeyByPrefix(ctx, prefix)
+	if err == model.ErrAPIKeyNotFound {
+		return nil, errInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if !auth.CheckAPIKeySecret(secret, apiKey.Hash) || !apiKey.Active(now) {
+		return nil, errInvalidAPIKey
+	}
+	s.apiKeyUsage.record(apiKey.ID, now)
+
+	return &auth.Principal{
+		Type:    auth.PrincipalAPIKey,
+		Subject: apiKey.ID.String(),
+		Roles:   apiKey.Scopes,
+	}, nil
+}
+
+// usageTracker collects when API keys or sessions were last used, so the
+// database is not written to on every request. The usage is flushed
+// periodically.
+type usageTracker struct {
+	mu   sync.Mutex
+	used map[uuid.UUID]time.Time
+}
+
+func (u *usageTracker) record(id uuid.UUID, at time.Time) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.used == nil {
+		u.used = map[uuid.UUID]time.Time{}
+	}
+	u.used[id] = at
+}
+
+func (u *usageTracker) take() map[uuid.UUID]time.Time {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	used := u.used
+	u.used = nil
+	return used
+}
+
+// flushUsage periodically stores when the API keys and sessions were last
+// used.
+func (s *server) flushUsage(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		for id, usedAt := range s.apiKeyUsage.take() {
+			if err := s.apiKeys.TouchAPIKey(context.Background(), id, usedAt); err != nil {
+				zap.L().Error("failed to update api key usage",
+					zap.String("apiKeyID", id.String()), zap.Error(err))
+			}
+		}
+		for id, seenAt := range s.sessionUsage.take() {
+			if err := s.sessions.TouchSession(context.Background(), id, seenAt); err != nil {
+				zap.L().Error("failed to update session usage",
+					zap.String("sessionID", id.String()), zap.Error(err))
+			}
+		}
+	}
+}
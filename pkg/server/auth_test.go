@@ -0,0 +1,68 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/caquillo07/graphql-server-demo/conf"
+	"github.com/caquillo07/graphql-server-demo/pkg/model"
+)
+
+// unavailableSessions fails every session lookup, as when the database is
+// down.
+type unavailableSessions struct {
+	model.SessionRepository
+}
+
+func (unavailableSessions) FindSessionByTokenHash(ctx context.Context, tokenHash string) (*model.Session, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestAuthenticateFailures(t *testing.T) {
+	config := testConfig()
+	config.GraphQL.RateLimit.Enabled = true
+	config.GraphQL.RateLimit.Anonymous = conf.RateLimit{Rate: 1, Burst: 1}
+
+	tests := []struct {
+		name     string
+		header   http.Header
+		sessions model.SessionRepository
+		// statuses of two requests in a row from the same IP
+		want [2]int
+	}{
+		{
+			"wrong api key is charged",
+			http.Header{apiKeyHeader: {"not a key"}},
+			nil,
+			[2]int{http.StatusUnauthorized, http.StatusTooManyRequests},
+		},
+		{
+			"unknown session is charged",
+			http.Header{"Authorization": {"Bearer token"}},
+			nil,
+			[2]int{http.StatusUnauthorized, http.StatusTooManyRequests},
+		},
+		{
+			"lookup failure is not charged",
+			http.Header{"Authorization": {"Bearer token"}},
+			unavailableSessions{},
+			[2]int{http.StatusInternalServerError, http.StatusInternalServerError},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, config)
+			if tt.sessions != nil {
+				s.sessions = tt.sessions
+			}
+			for i, want := range tt.want {
+				w := postGraphQL(t, s, "192.0.2.1:1234", tt.header, `{ me { id } }`, nil)
+				if w.Code != want {
+					t.Errorf("request %d: status = %d, want %d: %s", i, w.Code, want, w.Body)
+				}
+			}
+		})
+	}
+}
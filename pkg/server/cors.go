@@ -0,0 +1,88 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/websocket"
+	"github.com/rs/cors"
+
+	"github.com/caquillo07/graphql-server-demo/conf"
+)
+
+// allowedOrigins matches origins against the configured ones, which are
+// exact origins, "*" for any, or origins with one wildcard.
+type allowedOrigins struct {
+	any       bool
+	exact     map[string]bool
+	wildcards [][2]string
+}
+
+func newAllowedOrigins(origins []string) *allowedOrigins {
+	a := &allowedOrigins{exact: map[string]bool{}}
+	for _, origin := range origins {
+		origin = strings.ToLower(origin)
+		if origin == "*" {
+			a.any = true
+		} else if i := strings.IndexByte(origin, '*'); i >= 0 {
+			a.wildcards = append(a.wildcards, [2]string{origin[:i], origin[i+1:]})
+		} else {
+			a.exact[origin] = true
+		}
+	}
+	return a
+}
+
+func (a *allowedOrigins) allowed(origin string) bool {
+	origin = strings.ToLower(origin)
+	if a.any || a.exact[origin] {
+		return true
+	}
+	for _, w := range a.wildcards {
+		prefix, suffix := w[0], w[1]
+		if len(origin) >= len(prefix)+len(suffix) && strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// newCORS returns the middleware answering cross-origin requests. Allowing
+// any origin along with credentials is refused, every site would then be
+// able to make requests as the user.
+func newCORS(config conf.Config, origins *allowedOrigins) (*cors.Cors, error) {
+	c := config.Server.CORS
+	if origins.any && c.AllowCredentials {
+		return nil, errors.New(`server.cors.allowedOrigins cannot be "*" with server.cors.allowCredentials`)
+	}
+	return cors.New(cors.Options{
+		AllowOriginFunc:  origins.allowed,
+		AllowedMethods:   c.AllowedMethods,
+		AllowedHeaders:   c.AllowedHeaders,
+		ExposedHeaders:   c.ExposedHeaders,
+		AllowCredentials: c.AllowCredentials,
+		MaxAge:           int(c.MaxAge.Seconds()),
+	}), nil
+}
+
+// websocketUpgrader returns the upgrader of the GraphQL websocket, which
+// accepts connections from the server's own origin and, when CORS is
+// enabled, from the allowed origins.
+func (s *server) websocketUpgrader() websocket.Upgrader {
+	return websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		CheckOrigin: func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				return true
+			}
+			if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+				return true
+			}
+			return s.config.Server.CORS.Enabled && s.corsOrigins.allowed(origin)
+		},
+	}
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/caquillo07/graphql-server-demo/conf"
+)
+
+func TestAllowedOrigins(t *testing.T) {
+	tests := []struct {
+		name    string
+		origins []string
+		origin  string
+		want    bool
+	}{
+		{"exact", []string{"https://example.com"}, "https://example.com", true},
+		{"exact ignores case", []string{"https://Example.com"}, "https://EXAMPLE.com", true},
+		{"other origin", []string{"https://example.com"}, "https://example.org", false},
+		{"other scheme", []string{"https://example.com"}, "http://example.com", false},
+		{"any", []string{"*"}, "https://example.org", true},
+		{"none", nil, "https://example.com", false},
+		{"wildcard subdomain", []string{"https://*.example.com"}, "https://app.example.com", true},
+		{"wildcard needs a subdomain", []string{"https://*.example.com"}, "https://example.com", false},
+		{"wildcard suffix must match", []string{"https://*.example.com"}, "https://app.example.com.evil.org", false},
+		{"wildcard port", []string{"http://localhost:*"}, "http://localhost:3000", true},
+		{"wildcard port other host", []string{"http://localhost:*"}, "http://localhost.evil.org:3000", false},
+		{"prefix and suffix do not overlap", []string{"https://a*a"}, "https://a", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newAllowedOrigins(tt.origins).allowed(tt.origin); got != tt.want {
+				t.Errorf("allowed(%q) = %v, want %v", tt.origin, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewCORSRefusesAnyOriginWithCredentials(t *testing.T) {
+	tests := []struct {
+		name        string
+		origins     []string
+		credentials bool
+		wantErr     bool
+	}{
+		{"any with credentials", []string{"*"}, true, true},
+		{"any without credentials", []string{"*"}, false, false},
+		{"listed with credentials", []string{"https://example.com"}, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var config conf.Config
+			config.Server.CORS.AllowedOrigins = tt.origins
+			config.Server.CORS.AllowCredentials = tt.credentials
+			_, err := newCORS(config, newAllowedOrigins(tt.origins))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("newCORS() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
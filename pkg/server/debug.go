@@ -0,0 +1,235 @@
+package server
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+
+	"github.com/caquillo07/graphql-server-demo/pkg/auth"
+	"github.com/caquillo07/graphql-server-demo/pkg/tracing"
+)
+
+// debugExtensionsHeader asks for the debug extensions on a single request,
+// it is only honored for admins.
+const debugExtensionsHeader = "X-Debug-Extensions"
+
+// debugTracer adds the Apollo tracing and the SQL statements run to the
+// extensions of the response, for developers to see why an operation is
+// slow. They are added to every response when graphql.debugExtensions is
+// set, or on requests from admins sending the debug header.
+// https://github.com/apollographql/apollo-tracing
+type debugTracer struct {
+	graphql.NopTracer
+
+	// always adds the extensions to every response
+	always bool
+}
+
+type debugTraceKey struct{}
+
+// debugTrace is what is recorded of an operation.
+type debugTrace struct {
+	start      time.Time
+	parsing    apolloPhase
+	validation apolloPhase
+	statements tracing.StatementLog
+
+	mu        sync.Mutex
+	resolvers []*apolloResolver
+}
+
+type debugResolverKey struct{}
+
+// offset is the time since the start of the operation, in nanoseconds.
+func (t *debugTrace) offset(at time.Time) int64 {
+	return at.Sub(t.start).Nanoseconds()
+}
+
+func debugTraceFromContext(ctx context.Context) *debugTrace {
+	trace, _ := ctx.Value(debugTraceKey{}).(*debugTrace)
+	return trace
+}
+
+// enabled reports whether the extensions are added to the response of the
+// request.
+func (t debugTracer) enabled(ctx context.Context) bool {
+	if t.always {
+		return true
+	}
+	hc, ok := httpContextFrom(ctx)
+	if !ok {
+		return false
+	}
+	if on, _ := strconv.ParseBool(hc.r.Header.Get(debugExtensionsHeader)); !on {
+		return false
+	}
+	principal, ok := auth.PrincipalFromContext(ctx)
+	return ok && principal.HasRole(auth.RoleAdmin)
+}
+
+// start begins recording the operation, parsing is the first step of HTTP
+// requests while websocket operations are only seen once executed.
+func (t debugTracer) start(ctx context.Context) context.Context {
+	if debugTraceFromContext(ctx) != nil || !t.enabled(ctx) {
+		return ctx
+	}
+	trace := &debugTrace{start: time.Now()}
+	ctx = context.WithValue(ctx, debugTraceKey{}, trace)
+	return tracing.ContextWithStatementLog(ctx, &trace.statements)
+}
+
+func (t debugTracer) StartOperationParsing(ctx context.Context) context.Context {
+	ctx = t.start(ctx)
+	if trace := debugTraceFromContext(ctx); trace != nil {
+		trace.parsing.StartOffset = trace.offset(time.Now())
+	}
+	return ctx
+}
+
+func (t debugTracer) EndOperationParsing(ctx context.Context) {
+	if trace := debugTraceFromContext(ctx); trace != nil {
+		trace.parsing.Duration = trace.offset(time.Now()) - trace.parsing.StartOffset
+	}
+}
+
+func (t debugTracer) StartOperationValidation(ctx context.Context) context.Context {
+	if trace := debugTraceFromContext(ctx); trace != nil {
+		trace.validation.StartOffset = trace.offset(time.Now())
+	}
+	return ctx
+}
+
+func (t debugTracer) EndOperationValidation(ctx context.Context) {
+	if trace := debugTraceFromContext(ctx); trace != nil {
+		trace.validation.Duration = trace.offset(time.Now()) - trace.validation.StartOffset
+	}
+}
+
+func (t debugTracer) StartOperationExecution(ctx context.Context) context.Context {
+	return t.start(ctx)
+}
+
+func (t debugTracer) StartFieldResolverExecution(ctx context.Context, rc *graphql.ResolverContext) context.Context {
+	trace := debugTraceFromContext(ctx)
+	if trace == nil {
+		return ctx
+	}
+	resolver := &apolloResolver{
+		Path:        rc.Path(),
+		ParentType:  rc.Object,
+		FieldName:   rc.Field.Name,
+		StartOffset: trace.offset(time.Now()),
+	}
+	if rc.Field.Definition != nil {
+		resolver.ReturnType = rc.Field.Definition.Type.String()
+	}
+	trace.mu.Lock()
+	trace.resolvers = append(trace.resolvers, resolver)
+	trace.mu.Unlock()
+	return context.WithValue(ctx, debugResolverKey{}, resolver)
+}
+
+// StartFieldChildExecution ends the timing of the resolver, the time spent
+// on the fields of its result is not its own.
+func (t debugTracer) StartFieldChildExecution(ctx context.Context) context.Context {
+	t.endResolver(ctx)
+	return ctx
+}
+
+// EndFieldExecution ends the timing of resolvers that failed or returned
+// null, their children are never executed.
+func (t debugTracer) EndFieldExecution(ctx context.Context) {
+	t.endResolver(ctx)
+}
+
+func (t debugTracer) endResolver(ctx context.Context) {
+	trace := debugTraceFromContext(ctx)
+	resolver, ok := ctx.Value(debugResolverKey{}).(*apolloResolver)
+	if trace == nil || !ok {
+		return
+	}
+	trace.mu.Lock()
+	defer trace.mu.Unlock()
+	if resolver.Duration == 0 {
+		resolver.Duration = trace.offset(time.Now()) - resolver.StartOffset
+	}
+}
+
+func (t debugTracer) EndOperationExecution(ctx context.Context) {
+	trace := debugTraceFromContext(ctx)
+	if trace == nil {
+		return
+	}
+	end := time.Now()
+	trace.mu.Lock()
+	resolvers := make([]apolloResolver, len(trace.resolvers))
+	for i, r := range trace.resolvers {
+		resolvers[i] = *r
+	}
+	trace.mu.Unlock()
+
+	statements := trace.statements.Statements()
+	sqlStatements := make([]debugStatement, len(statements))
+	for i, statement := range statements {
+		sqlStatements[i] = debugStatement{
+			Query:       statement.Query,
+			StartOffset: trace.offset(statement.Start),
+			Duration:    statement.Duration.Nanoseconds(),
+		}
+		if statement.Err != nil {
+			sqlStatements[i].Error = statement.Err.Error()
+		}
+	}
+
+	reqCtx := graphql.GetRequestContext(ctx)
+	_ = reqCtx.RegisterExtension("tracing", apolloTracing{
+		Version:    1,
+		StartTime:  trace.start,
+		EndTime:    end,
+		Duration:   trace.offset(end),
+		Parsing:    trace.parsing,
+		Validation: trace.validation,
+		Execution:  apolloExecution{Resolvers: resolvers},
+	})
+	_ = reqCtx.RegisterExtension("sql", sqlStatements)
+}
+
+// The Apollo tracing format, offsets and durations are in nanoseconds.
+type apolloTracing struct {
+	Version    int             `json:"version"`
+	StartTime  time.Time       `json:"startTime"`
+	EndTime    time.Time       `json:"endTime"`
+	Duration   int64           `json:"duration"`
+	Parsing    apolloPhase     `json:"parsing"`
+	Validation apolloPhase     `json:"validation"`
+	Execution  apolloExecution `json:"execution"`
+}
+
+type apolloPhase struct {
+	StartOffset int64 `json:"startOffset"`
+	Duration    int64 `json:"duration"`
+}
+
+type apolloExecution struct {
+	Resolvers []apolloResolver `json:"resolvers"`
+}
+
+type apolloResolver struct {
+	Path        []interface{} `json:"path"`
+	ParentType  string        `json:"parentType"`
+	FieldName   string        `json:"fieldName"`
+	ReturnType  string        `json:"returnType"`
+	StartOffset int64         `json:"startOffset"`
+	Duration    int64         `json:"duration"`
+}
+
+// debugStatement is an SQL statement in the sql extension.
+type debugStatement struct {
+	Query       string `json:"query"`
+	StartOffset int64  `json:"startOffset"`
+	Duration    int64  `json:"duration"`
+	Error       string `json:"error,omitempty"`
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"context"
+
+	"github.com/99designs/gqlgen/graphql"
+
+	"github.com/caquillo07/graphql-server-demo/pkg/auth"
+	"github.com/caquillo07/graphql-server-demo/pkg/gqlgen/schema"
+)
+
+// hasRole only resolves the field when the principal of the request has
+// any of the roles. The OWNER role is granted when the field belongs to the
+// principal's own user.
+func (s *server) hasRole(ctx context.Context, obj interface{}, next graphql.Resolver, roles []schema.Role) (interface{}, error) {
+	principal, ok := auth.PrincipalFromContext(ctx)
+	if !ok {
+		return nil, errForbidden
+	}
+
+	for _, role := range roles {
+		if role == schema.RoleOwner {
+			user, ok := obj.(*schema.User)
+			if ok && principal.Type == auth.PrincipalUser && user.ID == principal.Subject {
+				return next(ctx)
+			}
+			continue
+		}
+		if principal.HasRole(string(role)) {
+			return next(ctx)
+		}
+	}
+	return nil, errForbidden
+}
+
+// noImpersonation only resolves the field when the principal is not an
+// admin impersonating a user.
+func (s *server) noImpersonation(ctx context.Context, obj interface{}, next graphql.Resolver) (interface{}, error) {
+	if principal, ok := auth.PrincipalFromContext(ctx); ok && principal.ImpersonatedBy != "" {
+		return nil, errImpersonationForbidden
+	}
+	return next(ctx)
+}
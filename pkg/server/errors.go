@@ -0,0 +1,42 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/gqlerror"
+)
+
+// writeError writes a GraphQL error response from outside of the GraphQL
+// handler, so clients can handle it like any other GraphQL error.
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	b, err := json.Marshal(&graphql.Response{Errors: gqlerror.List{{
+		Message:    message,
+		Extensions: map[string]interface{}{"code": code},
+	}}})
+	if err != nil {
+		panic(err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(b)
+}
+
+// codedError is an error returned by resolvers that carries a code in its
+// extensions, for clients to tell errors apart.
+type codedError struct {
+	code    string
+	message string
+}
+
+func (e *codedError) Error() string {
+	return e.message
+}
+
+func (e *codedError) Extensions() map[string]interface{} {
+	return map[string]interface{}{"code": e.code}
+}
+
+var errForbidden = &codedError{code: "FORBIDDEN", message: "not allowed to access this field"}
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/caquillo07/graphql-server-demo/pkg/federation"
+	"github.com/caquillo07/graphql-server-demo/pkg/model"
+)
+
+func (s *server) Service(ctx context.Context) (*federation.Service, error) {
+	return &federation.Service{SDL: s.sdl}, nil
+}
+
+// Entities resolves the representations sent by the gateway, in the same
+// order. Representations of entities that no longer exist resolve to null.
+func (s *server) Entities(ctx context.Context, representations []map[string]interface{}) ([]federation.Entity, error) {
+	entities := make([]federation.Entity, len(representations))
+	for i, rep := range representations {
+		typeName, _ := rep["__typename"].(string)
+		switch typeName {
+		case "User":
+			id, _ := rep["id"].(string)
+			userID, err := parseUserID(id)
+			if err != nil {
+				return nil, err
+			}
+
+			user, err := s.users.GetUser(ctx, userID)
+			if err == model.ErrUserNotFound {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			entities[i] = userToSchema(user)
+		default:
+			return nil, fmt.Errorf("unknown entity type %q", typeName)
+		}
+	}
+	return entities, nil
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/99designs/gqlgen/graphql"
+)
+
+// playgroundCSP lets the playground load its scripts and styles from the
+// CDN it is served from, and talk to the server over HTTP and websockets.
+const playgroundCSP = "default-src 'self'; " +
+	"script-src 'self' 'unsafe-inline' https://cdn.jsdelivr.net; " +
+	"style-src 'self' 'unsafe-inline' https://cdn.jsdelivr.net https://fonts.googleapis.com; " +
+	"font-src 'self' data: https://fonts.gstatic.com; " +
+	"img-src 'self' data: https:; " +
+	"connect-src 'self' ws: wss:; " +
+	"frame-ancestors 'none'"
+
+// apiCSP is the policy of every other response, none of which are meant to
+// load anything in a browser.
+const apiCSP = "default-src 'none'; frame-ancestors 'none'"
+
+var errOperationTimeout = &codedError{code: "TIMEOUT", message: "operation took too long"}
+
+// securityHeaders sets the headers that stop browsers from sniffing the
+// content type of responses or framing them.
+func securityHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("X-Frame-Options", "DENY")
+		h.Set("Referrer-Policy", "no-referrer")
+		h.Set("Content-Security-Policy", apiCSP)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// withPlaygroundCSP replaces the policy of the playground page, which
+// unlike the rest of the responses is a web page.
+func withPlaygroundCSP(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Security-Policy", playgroundCSP)
+		next(w, r)
+	}
+}
+
+// limitBody rejects request bodies larger than the configured size, those
+// without a known length failing once reading goes past it.
+func (s *server) limitBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		max := s.config.Server.MaxBodyBytes
+		if max <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.ContentLength > max {
+			writeError(w, http.StatusRequestEntityTooLarge, "REQUEST_TOO_LARGE", "request body is too large")
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, max)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// operationTimeout bounds how long each operation runs, over HTTP or a
+// websocket, by putting a deadline in the context resolvers and the
+// database queries they make are run with.
+func (s *server) operationTimeout(ctx context.Context, next func(ctx context.Context) []byte) []byte {
+	timeout := s.config.Server.OperationTimeout
+	if timeout <= 0 {
+		return next(ctx)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	res := next(ctx)
+	if ctx.Err() == context.DeadlineExceeded {
+		graphql.AddError(ctx, errOperationTimeout)
+	}
+	return res
+}
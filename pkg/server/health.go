@@ -0,0 +1,160 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/caquillo07/graphql-server-demo/pkg/model"
+)
+
+// readinessTimeout is how long each readiness check can take before it is
+// considered failed.
+const readinessTimeout = 2 * time.Second
+
+var errShuttingDown = errors.New("server is shutting down")
+
+// readinessCheck is a dependency the server needs to serve requests.
+type readinessCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// checkResult is the outcome of a check as reported by /readyz, only the
+// admin listener reports how long it took and why it failed.
+type checkResult struct {
+	Status   string `json:"status"`
+	Duration string `json:"duration,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+type healthResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]checkResult `json:"checks,omitempty"`
+}
+
+// newReadinessChecks returns the checks /readyz runs. The database ones are
+// only run when the server is backed by one.
+func (s *server) newReadinessChecks() []readinessCheck {
+	checks := []readinessCheck{{name: "shutdown", check: s.checkShutdown}}
+	if s.db == nil || s.db.DB() == nil {
+		return checks
+	}
+
+	checks = append(checks, readinessCheck{name: "database", check: s.checkDatabase})
+	latest, err := model.LatestMigration(s.config.Database.MigrationsDir)
+	if err != nil {
+		zap.L().Warn("not checking for pending migrations, failed to read them",
+			zap.String("dir", s.config.Database.MigrationsDir), zap.Error(err))
+		return checks
+	}
+	return append(checks, readinessCheck{name: "migrations", check: func(ctx context.Context) error {
+		return s.checkMigrations(ctx, latest)
+	}})
+}
+
+func (s *server) checkShutdown(ctx context.Context) error {
+	if atomic.LoadInt32(&s.shuttingDown) != 0 {
+		return errShuttingDown
+	}
+	return nil
+}
+
+func (s *server) checkDatabase(ctx context.Context) error {
+	return s.db.DB().PingContext(ctx)
+}
+
+func (s *server) checkMigrations(ctx context.Context, latest uint) error {
+	status, err := model.GetMigrationStatus(ctx, s.db, latest)
+	if err != nil {
+		return err
+	}
+	if status.Dirty {
+		return fmt.Errorf("migration %d failed and needs fixing by hand", status.Version)
+	}
+	if status.Pending() {
+		return fmt.Errorf("database is at version %d, migrations up to %d are pending", status.Version, status.Latest)
+	}
+	return nil
+}
+
+// healthz tells whether the process is up, it does not look at any of the
+// dependencies so the server is not restarted when one of them is down.
+func healthz(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, http.StatusOK, healthResponse{Status: "ok"})
+}
+
+// readyz tells whether the server can serve requests, running every check
+// at once. It fails as soon as a graceful shutdown starts, so the load
+// balancer stops sending requests before the server stops taking them.
+// The public listener only tells which checks failed, the errors can hold
+// details of the database that are for operators only.
+func (s *server) readyz(detailed bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		res := healthResponse{Status: "ok", Checks: make(map[string]checkResult, len(s.readinessChecks))}
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		for _, c := range s.readinessChecks {
+			wg.Add(1)
+			go func(c readinessCheck) {
+				defer wg.Done()
+				ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+				defer cancel()
+
+				start := time.Now()
+				err := runCheck(ctx, c.check)
+				result := checkResult{Status: "ok"}
+				if err != nil {
+					result.Status = "failed"
+				}
+				if detailed {
+					result.Duration = time.Since(start).String()
+					if err != nil {
+						result.Error = err.Error()
+					}
+				}
+
+				mu.Lock()
+				defer mu.Unlock()
+				res.Checks[c.name] = result
+				if err != nil {
+					res.Status = "unavailable"
+				}
+			}(c)
+		}
+		wg.Wait()
+
+		status := http.StatusOK
+		if res.Status != "ok" {
+			status = http.StatusServiceUnavailable
+		}
+		writeHealth(w, status, res)
+	}
+}
+
+// runCheck runs the check, giving up once the context is done even when
+// the check does not watch it.
+func runCheck(ctx context.Context, check func(ctx context.Context) error) error {
+	done := make(chan error, 1)
+	go func() { done <- check(ctx) }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func writeHealth(w http.ResponseWriter, status int, res healthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(res)
+}
@@ -0,0 +1,36 @@
+package server
+
+import (
+	"context"
+	"net/http"
+)
+
+type httpContextKey struct{}
+
+// httpContext is the HTTP request and response of a GraphQL operation, for
+// the resolvers that need to read or set headers and cookies.
+type httpContext struct {
+	w http.ResponseWriter
+	r *http.Request
+}
+
+// withHTTPContext makes the request and response available to resolvers.
+func withHTTPContext(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), httpContextKey{}, &httpContext{w: w, r: r})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func httpContextFrom(ctx context.Context) (*httpContext, bool) {
+	hc, ok := ctx.Value(httpContextKey{}).(*httpContext)
+	return hc, ok
+}
+
+// setCookie sets a cookie on the response of the operation, it must be
+// called before the response is written.
+func setCookie(ctx context.Context, cookie *http.Cookie) {
+	if hc, ok := httpContextFrom(ctx); ok {
+		http.SetCookie(hc.w, cookie)
+	}
+}
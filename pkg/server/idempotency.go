@@ -0,0 +1,260 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/vektah/gqlparser"
+	"github.com/vektah/gqlparser/ast"
+	"github.com/vektah/gqlparser/parser"
+	"go.uber.org/zap"
+
+	"github.com/caquillo07/graphql-server-demo/pkg/auth"
+	"github.com/caquillo07/graphql-server-demo/pkg/model"
+)
+
+const (
+	idempotencyKeyHeader      = "Idempotency-Key"
+	idempotencyReplayedHeader = "Idempotent-Replayed"
+
+	// maxIdempotencyKeyLength is the longest key a client can send
+	maxIdempotencyKeyLength = 255
+)
+
+// graphqlRequest is the body of a GraphQL request, all of it identifying
+// the request when comparing retries sent with the same idempotency key.
+type graphqlRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// idempotency replays the stored response of mutations retried with the
+// same Idempotency-Key header, instead of running them again. Queries and
+// requests without the header are passed through untouched, as are the
+// mutations starting a session: their response holds the session token,
+// which must not be stored, and replaying it would not set the cookie.
+func (s *server) idempotency(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyKeyHeader)
+		if key == "" || r.Method != http.MethodPost {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			writeError(w, http.StatusBadRequest, "BAD_REQUEST", "idempotency key is too long")
+			return
+		}
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		_ = r.Body.Close()
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "BAD_REQUEST", "request body could not be read")
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		// malformed requests are left for the GraphQL handler to report
+		var req graphqlRequest
+		if err := json.Unmarshal(body, &req); err != nil || !isMutation(req) || s.startsSession(req) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		hash, err := hashIdempotencyRequest(req)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// keys are scoped to the caller, so a key cannot be used to replay
+		// the response given to someone else. Anonymous callers can only be
+		// told apart by their IP.
+		principal, ok := auth.PrincipalFromContext(r.Context())
+		if ok {
+			key = principal.Subject + ":" + key
+		} else {
+			key = "ip:" + clientIP(r) + ":" + key
+		}
+
+		if !s.idempotencyLocks.lock(key) {
+			writeError(w, http.StatusConflict, "IDEMPOTENCY_KEY_IN_USE",
+				"a request with this idempotency key is still in progress")
+			return
+		}
+		defer s.idempotencyLocks.unlock(key)
+
+		record, err := s.idempotencyRecords.FindIdempotencyRecord(r.Context(), key)
+		if err != nil {
+			logger(r.Context()).Error("failed to find idempotency record", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "internal server error")
+			return
+		}
+		if record != nil {
+			if record.RequestHash != hash {
+				writeError(w, http.StatusUnprocessableEntity, "IDEMPOTENCY_KEY_CONFLICT",
+					"idempotency key was already used for a different request")
+				return
+			}
+			if ok && principal.ImpersonatedBy != "" {
+				s.auditImpersonated(r.Context(), principal, string(ast.Mutation), req.OperationName, req.Query, true)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set(idempotencyReplayedHeader, "true")
+			w.WriteHeader(record.StatusCode)
+			_, _ = w.Write(record.Response)
+			return
+		}
+
+		rec := &responseRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		// only successful executions are kept, anything else can be retried
+		if rec.statusCode != http.StatusOK || hasErrors(rec.body.Bytes()) {
+			return
+		}
+		now := time.Now()
+		err = s.idempotencyRecords.SaveIdempotencyRecord(r.Context(), &model.IdempotencyRecord{
+			Key:         key,
+			RequestHash: hash,
+			StatusCode:  rec.statusCode,
+			Response:    rec.body.Bytes(),
+			CreatedAt:   now,
+			ExpiresAt:   now.Add(s.config.GraphQL.IdempotencyTTL),
+		})
+		if err != nil {
+			logger(r.Context()).Error("failed to save idempotency record", zap.Error(err))
+		}
+	})
+}
+
+// purgeIdempotencyRecords periodically removes the expired idempotency
+// records so the storage does not grow forever.
+func (s *server) purgeIdempotencyRecords(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		err := s.idempotencyRecords.DeleteExpiredIdempotencyRecords(context.Background(), time.Now())
+		if err != nil {
+			zap.L().Error("failed to purge idempotency records", zap.Error(err))
+		}
+	}
+}
+
+func isMutation(req graphqlRequest) bool {
+	doc, err := parser.ParseQuery(&ast.Source{Input: req.Query})
+	if err != nil {
+		return false
+	}
+	op := doc.Operations.ForName(req.OperationName)
+	return op != nil && op.Operation == ast.Mutation
+}
+
+// startsSession reports whether the request selects an AuthPayload, the
+// result of the mutations logging a user in.
+func (s *server) startsSession(req graphqlRequest) bool {
+	doc, errs := gqlparser.LoadQuery(s.schema.Schema(), req.Query)
+	if errs != nil {
+		return false
+	}
+	op := doc.Operations.ForName(req.OperationName)
+	return op != nil && selectsType(op.SelectionSet, "AuthPayload")
+}
+
+func selectsType(set ast.SelectionSet, typ string) bool {
+	for _, selection := range set {
+		switch sel := selection.(type) {
+		case *ast.Field:
+			if sel.Definition != nil && sel.Definition.Type.Name() == typ {
+				return true
+			}
+			if selectsType(sel.SelectionSet, typ) {
+				return true
+			}
+		case *ast.InlineFragment:
+			if selectsType(sel.SelectionSet, typ) {
+				return true
+			}
+		case *ast.FragmentSpread:
+			if sel.Definition != nil && selectsType(sel.Definition.SelectionSet, typ) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasErrors reports whether the GraphQL response holds any error. gqlgen
+// responds 200 when resolvers fail too, so the status alone does not tell.
+func hasErrors(response []byte) bool {
+	var resp struct {
+		Errors []json.RawMessage `json:"errors"`
+	}
+	return json.Unmarshal(response, &resp) != nil || len(resp.Errors) > 0
+}
+
+// hashIdempotencyRequest hashes the request, encoding/json sorts the
+// variables so the same request always produces the same hash.
+func hashIdempotencyRequest(req graphqlRequest) (string, error) {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// keyLocks tracks the idempotency keys of the requests in progress, so a
+// retry sent before the first attempt finished is not executed twice.
+type keyLocks struct {
+	mu   sync.Mutex
+	keys map[string]struct{}
+}
+
+func (l *keyLocks) lock(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.keys == nil {
+		l.keys = map[string]struct{}{}
+	}
+	if _, ok := l.keys[key]; ok {
+		return false
+	}
+	l.keys[key] = struct{}{}
+	return true
+}
+
+func (l *keyLocks) unlock(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.keys, key)
+}
+
+// responseRecorder captures the response written by a handler while still
+// passing it through to the client.
+type responseRecorder struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(statusCode int) {
+	r.statusCode = statusCode
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+const createUserMutation = `mutation($input: CreateUserInput!) { createUser(input: $input) { id name } }`
+
+func TestIdempotencyReplaysMutations(t *testing.T) {
+	s := newTestServer(t, testConfig())
+	header := http.Header{idempotencyKeyHeader: {"key"}}
+	input := map[string]interface{}{"input": map[string]interface{}{"name": "Ada", "email": "ada@example.com"}}
+
+	first := postGraphQL(t, s, "192.0.2.1:1234", header, createUserMutation, input)
+	if resp := decodeResponse(t, first); len(resp.Errors) > 0 {
+		t.Fatalf("createUser failed: %v", resp.Errors)
+	}
+	if first.Header().Get(idempotencyReplayedHeader) != "" {
+		t.Error("first attempt was marked as replayed")
+	}
+
+	retry := postGraphQL(t, s, "192.0.2.1:1234", header, createUserMutation, input)
+	if retry.Header().Get(idempotencyReplayedHeader) != "true" {
+		t.Error("retry was not marked as replayed")
+	}
+	if retry.Body.String() != first.Body.String() {
+		t.Errorf("retry response = %s, want %s", retry.Body, first.Body)
+	}
+	users, err := s.users.ListUsers(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 {
+		t.Errorf("%d users were created, want 1", len(users))
+	}
+
+	other := map[string]interface{}{"input": map[string]interface{}{"name": "Ada", "email": "other@example.com"}}
+	if w := postGraphQL(t, s, "192.0.2.1:1234", header, createUserMutation, other); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("key reused for another request: status = %d, want %d", w.Code, http.StatusUnprocessableEntity)
+	}
+}
+
+func TestIdempotencyDoesNotKeepErrors(t *testing.T) {
+	s := newTestServer(t, testConfig())
+	header := http.Header{idempotencyKeyHeader: {"key"}}
+	input := map[string]interface{}{"input": map[string]interface{}{"name": "Ada", "email": "not an email"}}
+
+	// gqlgen responds 200 along with the errors
+	first := postGraphQL(t, s, "192.0.2.1:1234", header, createUserMutation, input)
+	if resp := decodeResponse(t, first); first.Code != http.StatusOK || len(resp.Errors) == 0 {
+		t.Fatalf("createUser with an invalid email: status %d, body %s", first.Code, first.Body)
+	}
+
+	retry := postGraphQL(t, s, "192.0.2.1:1234", header, createUserMutation, input)
+	if retry.Header().Get(idempotencyReplayedHeader) != "" {
+		t.Error("failed mutation was replayed instead of running again")
+	}
+}
+
+func TestIdempotencyScopesAnonymousKeysByIP(t *testing.T) {
+	s := newTestServer(t, testConfig())
+	header := http.Header{idempotencyKeyHeader: {"key"}}
+	input := map[string]interface{}{"input": map[string]interface{}{"name": "Ada", "email": "ada@example.com"}}
+
+	postGraphQL(t, s, "192.0.2.1:1234", header, createUserMutation, input)
+	w := postGraphQL(t, s, "192.0.2.2:1234", header, createUserMutation, input)
+	if w.Header().Get(idempotencyReplayedHeader) != "" {
+		t.Errorf("response given to another IP was replayed: %s", w.Body)
+	}
+}
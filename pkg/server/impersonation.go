@@ -0,0 +1,118 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"go.uber.org/zap"
+
+	"github.com/caquillo07/graphql-server-demo/pkg/auth"
+	"github.com/caquillo07/graphql-server-demo/pkg/gqlgen/schema"
+	"github.com/caquillo07/graphql-server-demo/pkg/model"
+)
+
+var (
+	errImpersonationForbidden = &codedError{code: "IMPERSONATION_FORBIDDEN", message: "not allowed while impersonating a user"}
+	errImpersonateAdmin       = &codedError{code: "FORBIDDEN", message: "admins cannot be impersonated"}
+)
+
+func (s *server) Impersonate(ctx context.Context, userID string) (*schema.AuthPayload, error) {
+	principal, ok := auth.PrincipalFromContext(ctx)
+	if !ok {
+		return nil, errUnauthenticated
+	}
+	id, err := parseUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.users.GetUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	for _, role := range user.Roles {
+		if role == auth.RoleAdmin {
+			return nil, errImpersonateAdmin
+		}
+	}
+
+	token, hash, err := auth.GenerateSessionToken()
+	if err != nil {
+		return nil, err
+	}
+	session := &model.Session{
+		UserID:         user.ID,
+		TokenHash:      hash,
+		ImpersonatedBy: principal.Subject,
+		ExpiresAt:      time.Now().Add(s.config.Auth.ImpersonationTTL),
+	}
+	if hc, ok := httpContextFrom(ctx); ok {
+		session.UserAgent = hc.r.UserAgent()
+		session.IP = clientIP(hc.r)
+	}
+	if err := s.sessions.CreateSession(ctx, session); err != nil {
+		return nil, err
+	}
+
+	logger(ctx).Info("impersonation started",
+		zap.String("user", user.ID.String()),
+		zap.String("impersonatedBy", principal.Subject),
+		zap.String("sessionID", session.ID.String()))
+	s.audit(ctx, &model.AuditRecord{
+		Actor:   principal.Subject,
+		Action:  "impersonate",
+		Details: user.ID.String(),
+	})
+
+	return &schema.AuthPayload{
+		Token:     token,
+		ExpiresAt: session.ExpiresAt,
+		User:      userToSchema(user),
+	}, nil
+}
+
+// auditImpersonation logs and audits every operation made by an admin
+// impersonating a user. Mutations replayed by the idempotency middleware
+// never get here, it audits them itself.
+func (s *server) auditImpersonation(ctx context.Context, next func(ctx context.Context) []byte) []byte {
+	principal, ok := auth.PrincipalFromContext(ctx)
+	if !ok || principal.ImpersonatedBy == "" {
+		return next(ctx)
+	}
+
+	operation := "query"
+	reqCtx := graphql.GetRequestContext(ctx)
+	if op := reqCtx.Doc.Operations.ForName(reqCtx.OperationName); op != nil {
+		operation = string(op.Operation)
+	}
+	s.auditImpersonated(ctx, principal, operation, reqCtx.OperationName, reqCtx.RawQuery, false)
+	return next(ctx)
+}
+
+// auditImpersonated logs and audits an operation made by an admin
+// impersonating the user of the principal.
+func (s *server) auditImpersonated(ctx context.Context, principal *auth.Principal, operation, operationName, query string, replayed bool) {
+	logger(ctx).Info("impersonated operation",
+		zap.String("user", principal.Subject),
+		zap.String("impersonatedBy", principal.ImpersonatedBy),
+		zap.String("operation", operation),
+		zap.String("operationName", operationName),
+		zap.Bool("replayed", replayed))
+	s.audit(ctx, &model.AuditRecord{
+		Actor:          principal.Subject,
+		ImpersonatedBy: principal.ImpersonatedBy,
+		Action:         operation,
+		Details:        query,
+	})
+}
+
+// audit stores the audit record, a failure is logged rather than failing
+// the action.
+func (s *server) audit(ctx context.Context, record *model.AuditRecord) {
+	if err := s.auditRecords.CreateAuditRecord(ctx, record); err != nil {
+		logger(ctx).Error("failed to store audit record",
+			zap.String("actor", record.Actor),
+			zap.String("action", record.Action),
+			zap.Error(err))
+	}
+}
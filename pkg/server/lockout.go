@@ -0,0 +1,147 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/caquillo07/graphql-server-demo/conf"
+	"github.com/caquillo07/graphql-server-demo/pkg/auth"
+)
+
+// errLoginLocked is returned for any email while it is locked out, whether
+// an account has it or not, so it does not tell the account exists.
+var errLoginLocked = &codedError{code: "TOO_MANY_ATTEMPTS", message: "too many failed login attempts, try again later"}
+
+func newLoginThrottle(config conf.Config) *auth.LoginThrottle {
+	lockout := config.Auth.Lockout
+	return &auth.LoginThrottle{
+		MaxAccountFailures: lockout.MaxAccountFailures,
+		MaxIPFailures:      lockout.MaxIPFailures,
+		Window:             lockout.Window,
+		LockoutDuration:    lockout.Duration,
+		BaseDelay:          lockout.BaseDelay,
+		MaxDelay:           lockout.MaxDelay,
+	}
+}
+
+// loginAttempt is an attempt reserved in the login throttle. It counts as
+// failed until it ends, callers defer release so attempts ending in errors
+// other than bad credentials are given back.
+type loginAttempt struct {
+	s       *server
+	ctx     context.Context
+	account string
+	ip      string
+	ended   bool
+}
+
+// throttleLogin reserves a login attempt and waits out its delay, failing
+// when the account or the client IP is locked out.
+func (s *server) throttleLogin(ctx context.Context, account, ip string) (*loginAttempt, error) {
+	delay, locked := s.loginThrottle.Check(account, ip, time.Now())
+	if locked {
+		return nil, errLoginLocked
+	}
+	attempt := &loginAttempt{s: s, ctx: ctx, account: account, ip: ip}
+	if delay == 0 {
+		return attempt, nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return attempt, nil
+	case <-ctx.Done():
+		attempt.release()
+		return nil, ctx.Err()
+	}
+}
+
+// failed records the attempt as failed, logging the lockouts it causes.
+func (a *loginAttempt) failed() {
+	if a.ended {
+		return
+	}
+	a.ended = true
+	accountLocked, ipLocked := a.s.loginThrottle.Failure(a.account, a.ip, time.Now())
+	if accountLocked {
+		logger(a.ctx).Warn("account locked out after failed logins",
+			zap.String("email", a.account),
+			zap.String("ip", a.ip),
+			zap.Duration("duration", a.s.loginThrottle.LockoutDuration))
+	}
+	if ipLocked {
+		logger(a.ctx).Warn("ip locked out after failed logins",
+			zap.String("ip", a.ip),
+			zap.Duration("duration", a.s.loginThrottle.LockoutDuration))
+	}
+}
+
+// succeeded records the attempt as successful, forgetting the failures of
+// the account.
+func (a *loginAttempt) succeeded() {
+	if a.ended {
+		return
+	}
+	a.ended = true
+	a.s.loginThrottle.Success(a.account, a.ip)
+}
+
+// release gives the attempt back if it has not ended otherwise.
+func (a *loginAttempt) release() {
+	if a.ended {
+		return
+	}
+	a.ended = true
+	a.s.loginThrottle.Release(a.account, a.ip)
+}
+
+func (s *server) UnlockUser(ctx context.Context, id string) (bool, error) {
+	userID, err := parseUserID(id)
+	if err != nil {
+		return false, err
+	}
+	user, err := s.users.GetUser(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+
+	s.loginThrottle.Unlock(loginAccount(user.Email))
+	principal, _ := auth.PrincipalFromContext(ctx)
+	logger(ctx).Info("account unlocked",
+		zap.String("userID", user.ID.String()),
+		zap.String("email", user.Email),
+		zap.String("by", principal.Subject))
+	return true, nil
+}
+
+// pruneLoginFailures forgets the failed logins and lockouts that are over
+// every interval.
+func (s *server) pruneLoginFailures(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		s.loginThrottle.Prune(now)
+	}
+}
+
+// loginAccount returns the key the failed logins of an email are tracked
+// by, so the same account is not tracked apart under different cases.
+func loginAccount(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// clientIP returns the IP the request came from.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/jinzhu/gorm"
+	"github.com/vektah/gqlparser/ast"
+
+	"github.com/caquillo07/graphql-server-demo/pkg/metrics"
+)
+
+// maxOperationNames bounds how many operation names the metrics are kept
+// by, since clients pick them. Operations past it are counted as "other".
+const maxOperationNames = 500
+
+// serverMetrics are the metrics the server exposes on the admin listener.
+type serverMetrics struct {
+	registry metrics.Registry
+
+	operations        *metrics.Counter
+	operationDuration *metrics.Histogram
+	resolverDuration  *metrics.Histogram
+	errors            *metrics.Counter
+	inFlight          *metrics.Gauge
+	subscriptions     *metrics.Gauge
+
+	mu             sync.Mutex
+	operationNames map[string]bool
+}
+
+func newServerMetrics(db *gorm.DB) *serverMetrics {
+	m := &serverMetrics{operationNames: map[string]bool{}}
+	m.operations = m.registry.NewCounter("graphql_operations_total",
+		"GraphQL operations run.", "operation", "type")
+	m.operationDuration = m.registry.NewHistogram("graphql_operation_duration_seconds",
+		"How long GraphQL operations took to run.", metrics.DefaultBuckets, "operation", "type")
+	m.resolverDuration = m.registry.NewHistogram("graphql_resolver_duration_seconds",
+		"How long resolvers took to run, by Type.field.", metrics.DefaultBuckets, "field")
+	m.errors = m.registry.NewCounter("graphql_errors_total",
+		"Errors in GraphQL responses, by code.", "code")
+	m.inFlight = m.registry.NewGauge("http_requests_in_flight",
+		"HTTP requests being served, websocket connections excluded.")
+	m.subscriptions = m.registry.NewGauge("graphql_subscriptions_active",
+		"GraphQL subscriptions running over websockets.")
+
+	if db != nil && db.DB() != nil {
+		sqlDB := db.DB()
+		m.registry.NewGaugeFunc("db_connections_max_open", "Most connections the pool opens.",
+			func() float64 { return float64(sqlDB.Stats().MaxOpenConnections) })
+		m.registry.NewGaugeFunc("db_connections_open", "Connections open, in use or idle.",
+			func() float64 { return float64(sqlDB.Stats().OpenConnections) })
+		m.registry.NewGaugeFunc("db_connections_in_use", "Connections running a statement.",
+			func() float64 { return float64(sqlDB.Stats().InUse) })
+		m.registry.NewGaugeFunc("db_connections_idle", "Connections open but unused.",
+			func() float64 { return float64(sqlDB.Stats().Idle) })
+		m.registry.NewCounterFunc("db_connections_wait_total", "Times a connection had to be waited for.",
+			func() float64 { return float64(sqlDB.Stats().WaitCount) })
+		m.registry.NewCounterFunc("db_connections_wait_seconds_total", "Time spent waiting for connections.",
+			func() float64 { return sqlDB.Stats().WaitDuration.Seconds() })
+	}
+	return m
+}
+
+// operationName returns the name the metrics of an operation are kept by.
+func (m *serverMetrics) operationName(name string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.operationNames[name] {
+		return name
+	}
+	if len(m.operationNames) >= maxOperationNames {
+		return "other"
+	}
+	m.operationNames[name] = true
+	return name
+}
+
+// measureOperation records the count, duration and errors of operations.
+func (s *server) measureOperation(ctx context.Context, next func(ctx context.Context) []byte) []byte {
+	start := time.Now()
+	res := next(ctx)
+
+	reqCtx := graphql.GetRequestContext(ctx)
+	name, typ := "", ""
+	if op := reqCtx.Doc.Operations.ForName(reqCtx.OperationName); op != nil {
+		name, typ = op.Name, string(op.Operation)
+	}
+	name = s.metrics.operationName(name)
+	s.metrics.operations.Inc(name, typ)
+	s.metrics.operationDuration.Observe(time.Since(start).Seconds(), name, typ)
+
+	for _, err := range reqCtx.Errors {
+		code, _ := err.Extensions["code"].(string)
+		if code == "" {
+			code = "UNKNOWN"
+		}
+		s.metrics.errors.Inc(code)
+	}
+	return res
+}
+
+// measureResolver records how long resolvers take. Fields read straight
+// from a struct are left out, they take no time and would only add noise.
+func (s *server) measureResolver(ctx context.Context, next graphql.Resolver) (interface{}, error) {
+	rc := graphql.GetResolverContext(ctx)
+	if !rc.IsMethod {
+		return next(ctx)
+	}
+	start := time.Now()
+	res, err := next(ctx)
+	s.metrics.resolverDuration.Observe(time.Since(start).Seconds(), rc.Object+"."+rc.Field.Name)
+	return res, err
+}
+
+// countInFlight counts the requests being served. Websocket connections
+// are left out, they stay open for as long as the client wants.
+func (s *server) countInFlight(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		s.metrics.inFlight.Inc()
+		defer s.metrics.inFlight.Dec()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// measuredSchema counts the subscriptions running, which gqlgen has no
+// middleware for.
+type measuredSchema struct {
+	graphql.ExecutableSchema
+	subscriptions *metrics.Gauge
+}
+
+func (s measuredSchema) Subscription(ctx context.Context, op *ast.OperationDefinition) func() *graphql.Response {
+	next := s.ExecutableSchema.Subscription(ctx, op)
+	s.subscriptions.Inc()
+	var once sync.Once
+	return func() *graphql.Response {
+		res := next()
+		if res == nil {
+			once.Do(func() { s.subscriptions.Dec() })
+		}
+		return res
+	}
+}
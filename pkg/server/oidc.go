@@ -0,0 +1,274 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/caquillo07/graphql-server-demo/conf"
+	"github.com/caquillo07/graphql-server-demo/pkg/auth"
+	"github.com/caquillo07/graphql-server-demo/pkg/model"
+	"github.com/caquillo07/graphql-server-demo/pkg/tracing"
+)
+
+const (
+	// oidcFlowCookie keeps the state, nonce and PKCE verifier of a login
+	// while the user is at the provider
+	oidcFlowCookie = "oidc_flow"
+
+	// oidcFlowTTL is how long the user has to log in at the provider
+	oidcFlowTTL = 10 * time.Minute
+)
+
+var (
+	// errOIDCSubjectTaken is returned when the email of an OpenID Connect
+	// user belongs to a user already linked to another subject.
+	errOIDCSubjectTaken = errors.New("user is linked to another subject")
+
+	// errOIDCEmailMissing is returned when a user would be provisioned from
+	// an ID token without an email.
+	errOIDCEmailMissing = errors.New("id token has no email")
+)
+
+// newOIDCProvider returns the OpenID Connect provider, or nil when no
+// issuer is configured.
+func newOIDCProvider(config conf.Config) (*auth.OIDCProvider, error) {
+	oidc := config.Auth.OIDC
+	if oidc.Issuer == "" {
+		return nil, nil
+	}
+	if oidc.PostLoginURL != "" && !config.Auth.SessionCookie.Enabled {
+		// the redirect only carries the session in its cookie
+		return nil, errors.New("auth.oidc.postLoginURL needs auth.sessionCookie.enabled")
+	}
+	return &auth.OIDCProvider{
+		Issuer:       oidc.Issuer,
+		ClientID:     oidc.ClientID,
+		ClientSecret: oidc.ClientSecret,
+		RedirectURL:  oidc.RedirectURL,
+		Scopes:       oidc.Scopes,
+		Leeway:       config.Auth.Leeway,
+		Client:       &http.Client{Timeout: 10 * time.Second, Transport: &tracing.Transport{}},
+	}, nil
+}
+
+type oidcFlow struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+}
+
+// oidcLogin sends the user to the provider to log in.
+func (s *server) oidcLogin(w http.ResponseWriter, r *http.Request) {
+	var flow oidcFlow
+	var challenge string
+	var err error
+	if flow.State, err = auth.RandomToken(); err == nil {
+		if flow.Nonce, err = auth.RandomToken(); err == nil {
+			flow.Verifier, challenge, err = auth.NewPKCEVerifier()
+		}
+	}
+	if err != nil {
+		logger(r.Context()).Error("failed to start oidc login", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "failed to start login")
+		return
+	}
+
+	url, err := s.oidc.AuthCodeURL(r.Context(), flow.State, flow.Nonce, challenge)
+	if err != nil {
+		logger(r.Context()).Error("failed to reach oidc provider", zap.Error(err))
+		writeError(w, http.StatusBadGateway, "OIDC_UNAVAILABLE", "identity provider is unavailable")
+		return
+	}
+
+	b, _ := json.Marshal(flow)
+	http.SetCookie(w, s.newOIDCFlowCookie(base64.RawURLEncoding.EncodeToString(b), oidcFlowTTL))
+	http.Redirect(w, r, url, http.StatusFound)
+}
+
+// oidcCallback finishes the login when the provider sends the user back,
+// starting a session for the user linked to the ID token's subject, or a
+// TOTP challenge when the user has TOTP enabled.
+func (s *server) oidcCallback(w http.ResponseWriter, r *http.Request) {
+	// the flow is single use, whatever the outcome
+	http.SetCookie(w, s.newOIDCFlowCookie("", -1))
+
+	query := r.URL.Query()
+	if e := query.Get("error"); e != "" {
+		writeError(w, http.StatusUnauthorized, "OIDC_LOGIN_FAILED", "login failed at the identity provider: "+e)
+		return
+	}
+	flow, ok := oidcFlowFromCookie(r)
+	if !ok || subtle.ConstantTimeCompare([]byte(flow.State), []byte(query.Get("state"))) != 1 {
+		writeError(w, http.StatusBadRequest, "INVALID_OIDC_STATE", "login state is invalid or expired, log in again")
+		return
+	}
+
+	idToken, err := s.oidc.Exchange(r.Context(), query.Get("code"), flow.Verifier, flow.Nonce)
+	if err != nil {
+		logger(r.Context()).Warn("oidc code exchange failed", zap.Error(err))
+		writeError(w, http.StatusUnauthorized, "OIDC_LOGIN_FAILED", "login failed at the identity provider")
+		return
+	}
+
+	user, err := s.oidcUser(r.Context(), idToken)
+	if err == model.ErrEmailTaken || err == errOIDCSubjectTaken {
+		writeError(w, http.StatusConflict, "EMAIL_TAKEN", "email belongs to another account")
+		return
+	}
+	if err == errOIDCEmailMissing {
+		writeError(w, http.StatusUnauthorized, "OIDC_EMAIL_REQUIRED", "identity provider did not share an email")
+		return
+	}
+	if err != nil {
+		logger(r.Context()).Error("failed to find oidc user", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "failed to log in")
+		return
+	}
+
+	// the provider stands in for the password only, users with TOTP enabled
+	// still pass their second factor to loginTotp
+	if user.TOTPEnabled {
+		s.oidcTOTPChallenge(w, r, user)
+		return
+	}
+
+	payload, err := s.startSession(r.Context(), user)
+	if err != nil {
+		logger(r.Context()).Error("failed to start session", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "failed to log in")
+		return
+	}
+
+	if s.config.Auth.OIDC.PostLoginURL != "" {
+		http.Redirect(w, r, s.config.Auth.OIDC.PostLoginURL, http.StatusFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"token":     payload.Token,
+		"expiresAt": payload.ExpiresAt,
+		"userId":    user.ID.String(),
+	})
+}
+
+// oidcTOTPChallenge responds with the challenge the user passes to
+// loginTotp, sending it along to the post login URL when there is one.
+func (s *server) oidcTOTPChallenge(w http.ResponseWriter, r *http.Request, user *model.User) {
+	challenge, err := s.startTOTPChallenge(user)
+	if err != nil {
+		logger(r.Context()).Error("failed to start totp challenge", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "failed to log in")
+		return
+	}
+
+	if postLogin := s.config.Auth.OIDC.PostLoginURL; postLogin != "" {
+		u, err := url.Parse(postLogin)
+		if err != nil {
+			logger(r.Context()).Error("invalid post login url", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "failed to log in")
+			return
+		}
+		q := u.Query()
+		q.Set("totpChallenge", challenge)
+		u.RawQuery = q.Encode()
+		http.Redirect(w, r, u.String(), http.StatusFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"totpChallenge": challenge,
+	})
+}
+
+// oidcUser returns the user linked to the subject of the ID token. Users
+// not linked yet are linked by their email when the provider verified it
+// and linking by email is enabled, otherwise a new user is created.
+func (s *server) oidcUser(ctx context.Context, idToken *auth.IDToken) (*model.User, error) {
+	user, err := s.users.FindUserByOIDCSubject(ctx, idToken.Subject)
+	if err != model.ErrUserNotFound {
+		return user, err
+	}
+	if idToken.Email == "" {
+		return nil, errOIDCEmailMissing
+	}
+
+	now := time.Now()
+	if s.config.Auth.OIDC.LinkByEmail && idToken.EmailVerified {
+		user, err := s.users.FindUserByEmail(ctx, idToken.Email)
+		if err == nil {
+			if user.OIDCSubject != "" {
+				return nil, errOIDCSubjectTaken
+			}
+			user.OIDCSubject = idToken.Subject
+			if user.EmailVerifiedAt == nil {
+				user.EmailVerifiedAt = &now
+			}
+			if err := s.users.UpdateUser(ctx, user); err != nil {
+				return nil, err
+			}
+			logger(ctx).Info("linked oidc subject to user",
+				zap.String("userID", user.ID.String()), zap.String("subject", idToken.Subject))
+			return user, nil
+		}
+		if err != model.ErrUserNotFound {
+			return nil, err
+		}
+	}
+
+	name := idToken.Name
+	if name == "" {
+		name = strings.SplitN(idToken.Email, "@", 2)[0]
+	}
+	user = &model.User{
+		Name:        name,
+		Email:       idToken.Email,
+		OIDCSubject: idToken.Subject,
+	}
+	if idToken.EmailVerified {
+		user.EmailVerifiedAt = &now
+	}
+	if err := s.users.CreateUser(ctx, user); err != nil {
+		return nil, err
+	}
+	logger(ctx).Info("provisioned user from oidc",
+		zap.String("userID", user.ID.String()), zap.String("subject", idToken.Subject))
+	return user, nil
+}
+
+func (s *server) newOIDCFlowCookie(value string, maxAge time.Duration) *http.Cookie {
+	return &http.Cookie{
+		Name:     oidcFlowCookie,
+		Value:    value,
+		Path:     "/auth/oidc",
+		MaxAge:   int(maxAge / time.Second),
+		Secure:   s.config.Auth.SessionCookie.Secure,
+		HttpOnly: true,
+		// Lax so the cookie comes along on the provider's redirect back
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+func oidcFlowFromCookie(r *http.Request) (*oidcFlow, bool) {
+	cookie, err := r.Cookie(oidcFlowCookie)
+	if err != nil {
+		return nil, false
+	}
+	b, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+	if err != nil {
+		return nil, false
+	}
+	var flow oidcFlow
+	if err := json.Unmarshal(b, &flow); err != nil || flow.State == "" {
+		return nil, false
+	}
+	return &flow, true
+}
@@ -0,0 +1,233 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/caquillo07/graphql-server-demo/conf"
+	"github.com/caquillo07/graphql-server-demo/pkg/model"
+	"github.com/caquillo07/graphql-server-demo/pkg/oidcstub"
+)
+
+// newOIDCTestServer returns a server logging in through a stub provider
+// that logs everyone in as the user.
+func newOIDCTestServer(t *testing.T, config conf.Config, user oidcstub.User) (*server, func()) {
+	var stub *oidcstub.Provider
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stub.ServeHTTP(w, r)
+	}))
+	var err error
+	if stub, err = oidcstub.New(provider.URL, "client", user); err != nil {
+		t.Fatal(err)
+	}
+
+	config.Auth.OIDC.Issuer = provider.URL
+	config.Auth.OIDC.ClientID = "client"
+	config.Auth.OIDC.RedirectURL = "http://gql.test/auth/oidc/callback"
+	return newTestServer(t, config), provider.Close
+}
+
+// startOIDCLogin goes through the login route and the provider, returning
+// the flow cookie and the query the provider sends the user back with.
+func startOIDCLogin(t *testing.T, s *server) (*http.Cookie, url.Values) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	s.httpServer.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/auth/oidc/login", nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("login: status = %d: %s", w.Code, w.Body)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != oidcFlowCookie {
+		t.Fatalf("login set cookies %v, want the flow cookie", cookies)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	callback, err := resp.Location()
+	if err != nil {
+		t.Fatalf("provider did not redirect back: %v", err)
+	}
+	return cookies[0], callback.Query()
+}
+
+func oidcCallback(t *testing.T, s *server, cookie *http.Cookie, query url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodGet, "/auth/oidc/callback?"+query.Encode(), nil)
+	if cookie != nil {
+		r.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	s.httpServer.Handler.ServeHTTP(w, r)
+	return w
+}
+
+// tamperFlow returns the flow cookie with its flow changed.
+func tamperFlow(t *testing.T, cookie *http.Cookie, change func(flow *oidcFlow)) *http.Cookie {
+	t.Helper()
+	flow, ok := oidcFlowFromCookie(&http.Request{Header: http.Header{"Cookie": {cookie.String()}}})
+	if !ok {
+		t.Fatal("flow cookie cannot be read")
+	}
+	change(flow)
+	b, err := json.Marshal(flow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &http.Cookie{Name: cookie.Name, Value: base64.RawURLEncoding.EncodeToString(b)}
+}
+
+func errorCode(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var body struct {
+		Errors []struct {
+			Extensions struct{ Code string }
+		}
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || len(body.Errors) == 0 {
+		t.Fatalf("status %d with body %s, want an error", w.Code, w.Body)
+	}
+	return body.Errors[0].Extensions.Code
+}
+
+var stubUser = oidcstub.User{Subject: "subject", Email: "user@example.com", EmailVerified: true, Name: "User"}
+
+func TestOIDCCallbackProvisionsUser(t *testing.T) {
+	s, closeProvider := newOIDCTestServer(t, testConfig(), stubUser)
+	defer closeProvider()
+
+	cookie, query := startOIDCLogin(t, s)
+	w := oidcCallback(t, s, cookie, query)
+	var resp struct {
+		Token  string
+		UserID string
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK || resp.Token == "" {
+		t.Fatalf("callback: status %d, body %s", w.Code, w.Body)
+	}
+
+	user, err := s.users.FindUserByOIDCSubject(context.Background(), stubUser.Subject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID.String() != resp.UserID || user.Email != stubUser.Email || user.EmailVerifiedAt == nil {
+		t.Errorf("provisioned user = %+v, logged in as %s", user, resp.UserID)
+	}
+	if _, err := s.authenticateSession(context.Background(), resp.Token); err != nil {
+		t.Errorf("session token does not authenticate: %v", err)
+	}
+
+	// the code is single use, and so is the flow
+	if w := oidcCallback(t, s, cookie, query); w.Code != http.StatusUnauthorized {
+		t.Errorf("replayed callback: status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestOIDCCallbackChecksTheFlow(t *testing.T) {
+	s, closeProvider := newOIDCTestServer(t, testConfig(), stubUser)
+	defer closeProvider()
+
+	cookie, query := startOIDCLogin(t, s)
+	if code := errorCode(t, oidcCallback(t, s, nil, query)); code != "INVALID_OIDC_STATE" {
+		t.Errorf("without the flow cookie: error = %s, want INVALID_OIDC_STATE", code)
+	}
+
+	cookie, query = startOIDCLogin(t, s)
+	forged := url.Values{"code": {query.Get("code")}, "state": {"forged"}}
+	if code := errorCode(t, oidcCallback(t, s, cookie, forged)); code != "INVALID_OIDC_STATE" {
+		t.Errorf("with another state: error = %s, want INVALID_OIDC_STATE", code)
+	}
+
+	// a code intercepted on its way back cannot be exchanged without the
+	// verifier of the flow that asked for it
+	cookie, query = startOIDCLogin(t, s)
+	cookie = tamperFlow(t, cookie, func(flow *oidcFlow) { flow.Verifier = "another verifier" })
+	if code := errorCode(t, oidcCallback(t, s, cookie, query)); code != "OIDC_LOGIN_FAILED" {
+		t.Errorf("with another PKCE verifier: error = %s, want OIDC_LOGIN_FAILED", code)
+	}
+
+	// nor can an ID token issued for another login
+	cookie, query = startOIDCLogin(t, s)
+	cookie = tamperFlow(t, cookie, func(flow *oidcFlow) { flow.Nonce = "another nonce" })
+	if code := errorCode(t, oidcCallback(t, s, cookie, query)); code != "OIDC_LOGIN_FAILED" {
+		t.Errorf("with another nonce: error = %s, want OIDC_LOGIN_FAILED", code)
+	}
+
+	if code := errorCode(t, oidcCallback(t, s, nil, url.Values{"error": {"access_denied"}})); code != "OIDC_LOGIN_FAILED" {
+		t.Errorf("with an error from the provider: error = %s, want OIDC_LOGIN_FAILED", code)
+	}
+
+	if users, _ := s.users.ListUsers(context.Background()); len(users) != 0 {
+		t.Errorf("failed logins provisioned %d users", len(users))
+	}
+}
+
+func TestOIDCCallbackExistingEmail(t *testing.T) {
+	for _, linkByEmail := range []bool{false, true} {
+		config := testConfig()
+		config.Auth.OIDC.LinkByEmail = linkByEmail
+		s, closeProvider := newOIDCTestServer(t, config, stubUser)
+
+		existing := &model.User{Name: "User", Email: stubUser.Email, PasswordHash: "hash"}
+		if err := s.users.CreateUser(context.Background(), existing); err != nil {
+			t.Fatal(err)
+		}
+		cookie, query := startOIDCLogin(t, s)
+		w := oidcCallback(t, s, cookie, query)
+		closeProvider()
+
+		if !linkByEmail {
+			if code := errorCode(t, w); code != "EMAIL_TAKEN" {
+				t.Errorf("without linking: error = %s, want EMAIL_TAKEN", code)
+			}
+			continue
+		}
+		var resp struct{ UserID string }
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.UserID != existing.ID.String() {
+			t.Errorf("with linking: status %d, body %s, want the existing user", w.Code, w.Body)
+		}
+	}
+}
+
+func TestOIDCCallbackRequiresEmail(t *testing.T) {
+	user := stubUser
+	user.Email = ""
+	s, closeProvider := newOIDCTestServer(t, testConfig(), user)
+	defer closeProvider()
+
+	cookie, query := startOIDCLogin(t, s)
+	if code := errorCode(t, oidcCallback(t, s, cookie, query)); code != "OIDC_EMAIL_REQUIRED" {
+		t.Errorf("error = %s, want OIDC_EMAIL_REQUIRED", code)
+	}
+}
+
+func TestOIDCCallbackTOTP(t *testing.T) {
+	s, closeProvider := newOIDCTestServer(t, testConfig(), stubUser)
+	defer closeProvider()
+
+	ctx := context.Background()
+	user := &model.User{Name: "User", Email: stubUser.Email, OIDCSubject: stubUser.Subject, TOTPSecret: "secret", TOTPEnabled: true}
+	if err := s.users.CreateUser(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+
+	cookie, query := startOIDCLogin(t, s)
+	w := oidcCallback(t, s, cookie, query)
+	var resp map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp["totpChallenge"] == nil || resp["token"] != nil {
+		t.Errorf("callback: status %d, body %s, want a TOTP challenge only", w.Code, w.Body)
+	}
+	if sessions, _ := s.sessions.ListSessions(ctx, user.ID); len(sessions) != 0 {
+		t.Errorf("%d sessions started before the second factor", len(sessions))
+	}
+}
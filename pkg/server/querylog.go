@@ -0,0 +1,139 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/ast"
+	"github.com/vektah/gqlparser/lexer"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/caquillo07/graphql-server-demo/conf"
+	"github.com/caquillo07/graphql-server-demo/pkg/auth"
+)
+
+// redactedValue replaces the values of sensitive variables in the logs
+const redactedValue = "[REDACTED]"
+
+// newQueryLogger returns the logger operations are logged with, which
+// samples them once there are more than the configured rate each second.
+func newQueryLogger(config conf.Config) *zap.Logger {
+	c := config.GraphQL.QueryLog
+	if c.SampleRate <= 0 {
+		return zap.L()
+	}
+	thereafter := c.SampleThereafter
+	if thereafter < 1 {
+		thereafter = 1
+	}
+	return zap.L().WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return zapcore.NewSampler(core, time.Second, c.SampleRate, thereafter)
+	}))
+}
+
+// logOperation logs every operation once it has run, with the variables
+// that could hold secrets redacted. The document is only logged as a hash
+// since literal values in it can hold secrets too.
+func (s *server) logOperation(ctx context.Context, next func(ctx context.Context) []byte) []byte {
+	start := time.Now()
+	res := next(ctx)
+	duration := time.Since(start)
+
+	reqCtx := graphql.GetRequestContext(ctx)
+	name, typ := reqCtx.OperationName, ""
+	if op := reqCtx.Doc.Operations.ForName(reqCtx.OperationName); op != nil {
+		name, typ = op.Name, string(op.Operation)
+	}
+	fields := []zap.Field{
+		zap.String("operation", name),
+		zap.String("type", typ),
+		zap.String("documentHash", hashDocument(reqCtx.RawQuery)),
+		zap.Any("variables", redactVariables(reqCtx.Variables, s.config.GraphQL.QueryLog.RedactVariables)),
+		zap.Duration("duration", duration),
+		zap.Int("errors", len(reqCtx.Errors)),
+	}
+	if id := requestIDFromContext(ctx); id != "" {
+		fields = append(fields, zap.String("requestID", id))
+	}
+	if principal, ok := auth.PrincipalFromContext(ctx); ok {
+		fields = append(fields,
+			zap.String("principal", principal.Subject),
+			zap.String("principalType", string(principal.Type)))
+		if principal.ImpersonatedBy != "" {
+			fields = append(fields, zap.String("impersonatedBy", principal.ImpersonatedBy))
+		}
+	}
+	s.queryLogger.Info("graphql operation", fields...)
+	return res
+}
+
+// hashDocument hashes the document ignoring its whitespace, comments and
+// literal values, so the same operation always has the same hash no
+// matter how it is formatted or which values it was sent with.
+func hashDocument(query string) string {
+	l := lexer.New(&ast.Source{Input: query})
+	var b strings.Builder
+	for {
+		token, err := l.ReadToken()
+		if err != nil || token.Kind == lexer.EOF {
+			break
+		}
+		switch token.Kind {
+		case lexer.Name:
+			b.WriteString(token.Value)
+		default:
+			b.WriteString(token.Kind.String())
+		}
+		b.WriteByte(' ')
+	}
+	sum := sha256.Sum256([]byte(b.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+// redactVariables returns a copy of the variables with the values of those
+// named like a sensitive one redacted, along with the fields of the input
+// objects in them.
+func redactVariables(vars map[string]interface{}, sensitive []string) map[string]interface{} {
+	if vars == nil {
+		return nil
+	}
+	redacted := make(map[string]interface{}, len(vars))
+	for name, value := range vars {
+		if isSensitive(name, sensitive) {
+			redacted[name] = redactedValue
+		} else {
+			redacted[name] = redactValue(value, sensitive)
+		}
+	}
+	return redacted
+}
+
+func redactValue(value interface{}, sensitive []string) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return redactVariables(v, sensitive)
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		for i := range v {
+			redacted[i] = redactValue(v[i], sensitive)
+		}
+		return redacted
+	default:
+		return value
+	}
+}
+
+func isSensitive(name string, sensitive []string) bool {
+	name = strings.ToLower(name)
+	for _, s := range sensitive {
+		if s != "" && strings.Contains(name, strings.ToLower(s)) {
+			return true
+		}
+	}
+	return false
+}
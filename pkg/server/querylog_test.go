@@ -0,0 +1,87 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRedactVariables(t *testing.T) {
+	sensitive := []string{"password", "Token", ""}
+
+	tests := []struct {
+		name string
+		vars map[string]interface{}
+		want map[string]interface{}
+	}{
+		{"nil", nil, nil},
+		{
+			"top level",
+			map[string]interface{}{"email": "a@b.c", "password": "hunter2"},
+			map[string]interface{}{"email": "a@b.c", "password": redactedValue},
+		},
+		{
+			"matched without case within the name",
+			map[string]interface{}{"newPassword": "hunter2", "resetTOKEN": "abc"},
+			map[string]interface{}{"newPassword": redactedValue, "resetTOKEN": redactedValue},
+		},
+		{
+			"input objects",
+			map[string]interface{}{"input": map[string]interface{}{"name": "a", "password": "hunter2"}},
+			map[string]interface{}{"input": map[string]interface{}{"name": "a", "password": redactedValue}},
+		},
+		{
+			"lists of input objects",
+			map[string]interface{}{"inputs": []interface{}{
+				map[string]interface{}{"name": "a", "password": "hunter2"},
+				"plain",
+			}},
+			map[string]interface{}{"inputs": []interface{}{
+				map[string]interface{}{"name": "a", "password": redactedValue},
+				"plain",
+			}},
+		},
+		{
+			"whole object under a sensitive name",
+			map[string]interface{}{"password": map[string]interface{}{"value": "hunter2"}},
+			map[string]interface{}{"password": redactedValue},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redactVariables(tt.vars, sensitive); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("redactVariables() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactVariablesKeepsInput(t *testing.T) {
+	vars := map[string]interface{}{"input": map[string]interface{}{"password": "hunter2"}}
+	redactVariables(vars, []string{"password"})
+	if got := vars["input"].(map[string]interface{})["password"]; got != "hunter2" {
+		t.Errorf("variables were changed, password = %v", got)
+	}
+}
+
+func TestHashDocument(t *testing.T) {
+	base := `query Login { user(id: "1") { name } }`
+
+	tests := []struct {
+		name  string
+		query string
+		same  bool
+	}{
+		{"formatting", "query Login {\n  user(id: \"1\") {\n    name\n  }\n}", true},
+		{"comments", "# comment\n" + base, true},
+		{"literal values", `query Login { user(id: "2") { name } }`, true},
+		{"other field", `query Login { user(id: "1") { email } }`, false},
+		{"other name", `query Other { user(id: "1") { name } }`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if same := hashDocument(tt.query) == hashDocument(base); same != tt.same {
+				t.Errorf("same hash = %v, want %v", same, tt.same)
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/99designs/gqlgen/complexity"
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser"
+	"github.com/vektah/gqlparser/ast"
+	"github.com/vektah/gqlparser/validator"
+
+	"github.com/caquillo07/graphql-server-demo/conf"
+	"github.com/caquillo07/graphql-server-demo/pkg/auth"
+	"github.com/caquillo07/graphql-server-demo/pkg/ratelimit"
+)
+
+var errRateLimited = &codedError{code: "RATE_LIMITED", message: "rate limit exceeded, try again later"}
+
+// rateLimit charges each request to the token bucket of its client, the
+// principal or API key that sent it or the IP of anonymous requests, and
+// rejects it once the bucket is empty. Websocket connections are charged
+// for the upgrade here, and for each operation by rateLimitOperation.
+func (s *server) rateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cost := 1
+		if s.config.GraphQL.RateLimit.ChargeComplexity {
+			cost = s.requestComplexity(r)
+		}
+		key, limit := s.rateLimitKey(r.Context(), clientIP(r))
+		if s.takeRateLimit(w, key, limit, cost) {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// chargeFailedAuth charges a request that failed to authenticate to the
+// bucket of its IP, so guessing credentials is limited like any anonymous
+// request. It reports whether the bucket still had a token.
+func (s *server) chargeFailedAuth(w http.ResponseWriter, r *http.Request) bool {
+	return s.takeRateLimit(w, "ip:"+clientIP(r), s.config.GraphQL.RateLimit.Anonymous, 1)
+}
+
+// takeRateLimit takes cost tokens from the bucket, setting the rate limit
+// headers. Once the bucket is empty it responds with RATE_LIMITED and
+// returns false.
+func (s *server) takeRateLimit(w http.ResponseWriter, key string, limit conf.RateLimit, cost int) bool {
+	res, limited := s.chargeRateLimit(key, limit, cost)
+	if !limited {
+		return true
+	}
+
+	h := w.Header()
+	h.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	h.Set("RateLimit-Reset", rateLimitSeconds(res.Reset))
+	if !res.Allowed {
+		h.Set("Retry-After", rateLimitSeconds(res.RetryAfter))
+		writeError(w, http.StatusTooManyRequests, errRateLimited.code, errRateLimited.message)
+		return false
+	}
+	return true
+}
+
+// chargeRateLimit takes cost tokens from the bucket, limited is false when
+// rate limiting is off for the class of the bucket.
+func (s *server) chargeRateLimit(key string, limit conf.RateLimit, cost int) (res ratelimit.Result, limited bool) {
+	if !s.config.GraphQL.RateLimit.Enabled || limit.Rate <= 0 {
+		return ratelimit.Result{Allowed: true}, false
+	}
+	if limit.Burst < 1 {
+		limit.Burst = 1
+	}
+	return s.rateLimiter.Take(key, ratelimit.Limit{Rate: limit.Rate, Burst: limit.Burst}, cost, time.Now()), true
+}
+
+// rateLimitOperation charges each operation sent over a websocket, the
+// connection stays open for as long as the client wants so charging the
+// upgrade alone would let it send as many as it likes. HTTP requests were
+// charged by rateLimit already.
+func (s *server) rateLimitOperation(ctx context.Context, next func(ctx context.Context) []byte) []byte {
+	hc, ok := httpContextFrom(ctx)
+	if !ok || !strings.EqualFold(hc.r.Header.Get("Upgrade"), "websocket") {
+		return next(ctx)
+	}
+
+	cost := 1
+	if s.config.GraphQL.RateLimit.ChargeComplexity {
+		reqCtx := graphql.GetRequestContext(ctx)
+		if op := reqCtx.Doc.Operations.ForName(reqCtx.OperationName); op != nil {
+			cost = s.operationComplexity(op, reqCtx.Variables)
+		}
+	}
+	key, limit := s.rateLimitKey(ctx, clientIP(hc.r))
+	if res, limited := s.chargeRateLimit(key, limit, cost); limited && !res.Allowed {
+		graphql.AddError(ctx, errRateLimited)
+		return nil
+	}
+	return next(ctx)
+}
+
+// rateLimitKey returns the bucket the requests of the context are charged
+// to, and the limit of its class.
+func (s *server) rateLimitKey(ctx context.Context, ip string) (string, conf.RateLimit) {
+	limits := s.config.GraphQL.RateLimit
+	principal, ok := auth.PrincipalFromContext(ctx)
+	switch {
+	case !ok:
+		return "ip:" + ip, limits.Anonymous
+	case principal.Type == auth.PrincipalAPIKey, principal.Type == auth.PrincipalClientCert:
+		return string(principal.Type) + ":" + principal.Subject, limits.APIKey
+	default:
+		return "user:" + principal.Subject, limits.User
+	}
+}
+
+// requestComplexity returns the complexity of the operation of the
+// request. Requests that cannot be parsed or fail validation cost 1, the
+// GraphQL handler rejects them without running anything.
+func (s *server) requestComplexity(r *http.Request) int {
+	req, ok := readGraphQLRequest(r)
+	if !ok {
+		return 1
+	}
+	doc, errs := gqlparser.LoadQuery(s.schema.Schema(), req.Query)
+	if len(errs) > 0 {
+		return 1
+	}
+	op := doc.Operations.ForName(req.OperationName)
+	if op == nil {
+		return 1
+	}
+	vars, err := validator.VariableValues(s.schema.Schema(), op, req.Variables)
+	if err != nil {
+		return 1
+	}
+	return s.operationComplexity(op, vars)
+}
+
+// operationComplexity returns the complexity of the validated operation,
+// at least 1.
+func (s *server) operationComplexity(op *ast.OperationDefinition, vars map[string]interface{}) int {
+	if c := complexity.Calculate(s.schema, op, vars); c > 1 {
+		return c
+	}
+	return 1
+}
+
+// pruneRateLimits forgets the buckets of the clients that have not made a
+// request for long enough to refill them, every interval.
+func (s *server) pruneRateLimits(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		s.rateLimiter.Prune(now)
+	}
+}
+
+// readGraphQLRequest reads the GraphQL request from the query string of
+// GET requests or the JSON body of POST ones, putting the body back for
+// the handlers after it.
+func readGraphQLRequest(r *http.Request) (graphqlRequest, bool) {
+	var req graphqlRequest
+	switch r.Method {
+	case http.MethodGet:
+		req.Query = r.URL.Query().Get("query")
+		req.OperationName = r.URL.Query().Get("operationName")
+		if vars := r.URL.Query().Get("variables"); vars != "" {
+			if err := json.Unmarshal([]byte(vars), &req.Variables); err != nil {
+				return req, false
+			}
+		}
+		return req, req.Query != ""
+	case http.MethodPost:
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+			return req, false
+		}
+		body, err := ioutil.ReadAll(r.Body)
+		_ = r.Body.Close()
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		if err != nil {
+			return req, false
+		}
+		return req, json.Unmarshal(body, &req) == nil
+	}
+	return req, false
+}
+
+// rateLimitSeconds formats the duration as the whole seconds the RateLimit
+// headers are given in, rounding up so clients do not retry too early.
+func rateLimitSeconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
@@ -0,0 +1,176 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"go.uber.org/zap"
+)
+
+const (
+	requestIDHeader = "X-Request-ID"
+
+	// maxRequestIDLength is the longest request ID accepted from clients
+	maxRequestIDLength = 128
+)
+
+var errInternal = &codedError{code: "INTERNAL", message: "internal server error"}
+
+type requestIDKey struct{}
+type loggerKey struct{}
+
+// withRequestID gives each request an ID, the one sent by the client or a
+// proxy in front when it looks sane, and sends it back so both sides can
+// refer to the request. Everything logged through logger(ctx) carries it.
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+
+		ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+		ctx = context.WithValue(ctx, loggerKey{}, zap.L().With(zap.String("requestID", id)))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// validRequestID reports whether the ID can be logged and echoed as is.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < '!' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
+}
+
+// requestIDFromContext returns the ID of the request being served, empty
+// outside of one.
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// logger returns the logger of the request being served, which adds its ID
+// to every entry, or the global one outside of a request.
+func logger(ctx context.Context) *zap.Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*zap.Logger); ok {
+		return l
+	}
+	return zap.L()
+}
+
+// accessLog logs one line for each request once it is served. Websocket
+// connections are logged when they close. The probes of the health checks
+// are left out, they would drown the requests of clients.
+func accessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" || r.URL.Path == "/readyz" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		next.ServeHTTP(sw, r)
+
+		logger(r.Context()).Info("request",
+			zap.String("method", r.Method),
+			zap.String("path", r.URL.Path),
+			zap.Int("status", sw.statusCode),
+			zap.Int("bytes", sw.bytes),
+			zap.Duration("duration", time.Since(start)),
+			zap.String("ip", clientIP(r)),
+			zap.String("userAgent", r.UserAgent()),
+		)
+	})
+}
+
+// recoverPanic turns panics outside of the GraphQL handler into INTERNAL
+// errors, logging the stack.
+func recoverPanic(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if err := recover(); err != nil {
+				if err == http.ErrAbortHandler {
+					panic(err)
+				}
+				logger(r.Context()).Error("panic serving request",
+					zap.Any("panic", err),
+					zap.Stack("stack"),
+				)
+				writeError(w, http.StatusInternalServerError, "INTERNAL", "internal server error")
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// recoverResolver logs a panic in a resolver along with the operation it
+// happened in, and hides it from the client behind an INTERNAL error.
+func recoverResolver(ctx context.Context, err interface{}) error {
+	fields := []zap.Field{zap.Any("panic", err), zap.Stack("stack")}
+	if reqCtx := graphql.GetRequestContext(ctx); reqCtx != nil {
+		name := reqCtx.OperationName
+		if op := reqCtx.Doc.Operations.ForName(reqCtx.OperationName); op != nil {
+			name = op.Name
+		}
+		fields = append(fields, zap.String("operation", name))
+	}
+	if rc := graphql.GetResolverContext(ctx); rc != nil {
+		fields = append(fields, zap.String("field", rc.Object+"."+rc.Field.Name))
+	}
+	logger(ctx).Error("panic in resolver", fields...)
+	return errInternal
+}
+
+// statusWriter keeps the status code and size of the response.
+type statusWriter struct {
+	http.ResponseWriter
+	statusCode int
+	bytes      int
+}
+
+func (w *statusWriter) WriteHeader(statusCode int) {
+	w.statusCode = statusCode
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += n
+	return n, err
+}
+
+// Hijack lets websocket connections be upgraded through the writer.
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response does not support hijacking")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err == nil {
+		w.statusCode = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
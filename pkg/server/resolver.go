@@ -2,11 +2,43 @@ package server
 
 import (
 	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/gofrs/uuid"
+	"go.uber.org/zap"
+
+	"github.com/caquillo07/graphql-server-demo/pkg/auth"
 	"github.com/caquillo07/graphql-server-demo/pkg/gqlgen/schema"
 	gqlServer "github.com/caquillo07/graphql-server-demo/pkg/gqlgen/server"
+	"github.com/caquillo07/graphql-server-demo/pkg/model"
+	"github.com/caquillo07/graphql-server-demo/pkg/ratelimit"
+)
+
+const (
+	// maxPageSize is the largest page a paginated query can request
+	maxPageSize = 100
+
+	// maxBulkSize is the most items a bulk mutation can receive
+	maxBulkSize = 1000
 )
 
+// createUserLimit is how many users an anonymous client can create, 5 at
+// once then one a minute, so an IP cannot squat many addresses.
+var createUserLimit = ratelimit.Limit{Rate: 1.0 / 60, Burst: 5}
+
+// validationError is returned when an input does not pass validation
+type validationError string
+
+func (e validationError) Error() string {
+	return string(e)
+}
+
 func (s *server) Mutation() gqlServer.MutationResolver {
 	return s
 }
@@ -15,6 +47,10 @@ func (s *server) Query() gqlServer.QueryResolver {
 	return s
 }
 
+func (s *server) User() gqlServer.UserResolver {
+	return s
+}
+
 func (s *server) UpdateUser(ctx context.Context, name string) (*schema.User, error) {
 	return &schema.User{
 		ID:   "123e4567-e89b-12d3-a456-426655440000",
@@ -22,11 +58,285 @@ func (s *server) UpdateUser(ctx context.Context, name string) (*schema.User, err
 	}, nil
 }
 
+func (s *server) CreateUser(ctx context.Context, input schema.CreateUserInput) (*schema.User, error) {
+	if err := validateCreateUserInput(input); err != nil {
+		return nil, err
+	}
+	if _, ok := auth.PrincipalFromContext(ctx); !ok {
+		if hc, ok := httpContextFrom(ctx); ok {
+			res := s.rateLimiter.Take("create:"+clientIP(hc.r), createUserLimit, 1, time.Now())
+			if !res.Allowed {
+				return nil, errRateLimited
+			}
+		}
+	}
+
+	user := &model.User{
+		Name:  strings.TrimSpace(input.Name),
+		Email: strings.TrimSpace(input.Email),
+	}
+	if err := s.users.CreateUser(ctx, user); err != nil {
+		return nil, err
+	}
+	return userToSchema(user), nil
+}
+
+func (s *server) DeleteUser(ctx context.Context, id string) (*schema.User, error) {
+	userID, err := parseUserID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.users.DeleteUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return userToSchema(user), nil
+}
+
+func (s *server) CreateUsers(ctx context.Context, inputs []*schema.CreateUserInput, partial *bool) (*schema.BulkUserPayload, error) {
+	if len(inputs) > maxBulkSize {
+		return nil, fmt.Errorf("at most %d users can be created at once", maxBulkSize)
+	}
+	isPartial := partial != nil && *partial
+
+	results := make([]*schema.BulkUserResult, len(inputs))
+	var users []*model.User
+	var positions []int
+	for i, input := range inputs {
+		results[i] = &schema.BulkUserResult{Index: i}
+		if err := validateCreateUserInput(*input); err != nil {
+			results[i].Error = toUserError(ctx, err)
+			continue
+		}
+		users = append(users, &model.User{
+			Name:  strings.TrimSpace(input.Name),
+			Email: strings.TrimSpace(input.Email),
+		})
+		positions = append(positions, i)
+	}
+
+	// there is no point in opening a transaction that is going to be
+	// rolled back
+	failed := len(users) < len(inputs)
+	if !failed || isPartial {
+		errs, err := s.users.CreateUsers(ctx, users, isPartial)
+		if err != nil {
+			return nil, err
+		}
+		for j, err := range errs {
+			res := results[positions[j]]
+			if err != nil {
+				res.Error = toUserError(ctx, err)
+				failed = true
+				continue
+			}
+			res.User = userToSchema(users[j])
+		}
+	}
+	return bulkUserPayload(results, isPartial, failed), nil
+}
+
+func (s *server) DeleteUsers(ctx context.Context, ids []string, partial *bool) (*schema.BulkUserPayload, error) {
+	if len(ids) > maxBulkSize {
+		return nil, fmt.Errorf("at most %d users can be deleted at once", maxBulkSize)
+	}
+	isPartial := partial != nil && *partial
+
+	results := make([]*schema.BulkUserResult, len(ids))
+	var userIDs []uuid.UUID
+	var positions []int
+	for i, id := range ids {
+		results[i] = &schema.BulkUserResult{Index: i}
+		userID, err := parseUserID(id)
+		if err != nil {
+			results[i].Error = toUserError(ctx, err)
+			continue
+		}
+		userIDs = append(userIDs, userID)
+		positions = append(positions, i)
+	}
+
+	failed := len(userIDs) < len(ids)
+	if !failed || isPartial {
+		users, errs, err := s.users.DeleteUsers(ctx, userIDs, isPartial)
+		if err != nil {
+			return nil, err
+		}
+		for j, err := range errs {
+			res := results[positions[j]]
+			if err != nil {
+				res.Error = toUserError(ctx, err)
+				failed = true
+				continue
+			}
+			res.User = userToSchema(users[j])
+		}
+	}
+	return bulkUserPayload(results, isPartial, failed), nil
+}
+
 func (s *server) GetUsers(ctx context.Context) ([]*schema.User, error) {
-	return []*schema.User{
-		{
-			ID:   "123e4567-e89b-12d3-a456-426655440000",
-			Name: "Bob",
-		},
-	}, nil
+	users, err := s.users.ListUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*schema.User, len(users))
+	for i, u := range users {
+		res[i] = userToSchema(u)
+	}
+	return res, nil
+}
+
+func (s *server) Me(ctx context.Context) (*schema.User, error) {
+	// principals that are not users, such as services, have no user
+	principal, ok := auth.PrincipalFromContext(ctx)
+	if !ok || principal.Type != auth.PrincipalUser {
+		return nil, nil
+	}
+
+	userID, err := uuid.FromString(principal.Subject)
+	if err != nil {
+		return nil, nil
+	}
+	user, err := s.users.GetUser(ctx, userID)
+	if err == model.ErrUserNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return userToSchema(user), nil
+}
+
+func (s *server) SearchUsers(ctx context.Context, query string, first *int, after *string) (*schema.UserSearchConnection, error) {
+	limit := 20
+	if first != nil {
+		limit = *first
+	}
+	if limit < 0 || limit > maxPageSize {
+		return nil, errors.New("first must be between 0 and " + strconv.Itoa(maxPageSize))
+	}
+
+	offset := 0
+	if after != nil {
+		var err error
+		if offset, err = decodeCursor(*after); err != nil {
+			return nil, err
+		}
+	}
+
+	// ask for one more than needed to know if there is a next page
+	results, err := s.users.SearchUsers(ctx, query, limit+1, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := &schema.UserSearchConnection{
+		Edges:    []*schema.UserSearchEdge{},
+		PageInfo: &schema.PageInfo{HasNextPage: len(results) > limit},
+	}
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	for i, r := range results {
+		conn.Edges = append(conn.Edges, &schema.UserSearchEdge{
+			Cursor:    encodeCursor(offset + i + 1),
+			Node:      userToSchema(r.User),
+			Rank:      r.Rank,
+			Highlight: r.Highlight,
+		})
+	}
+	if len(conn.Edges) > 0 {
+		conn.PageInfo.EndCursor = &conn.Edges[len(conn.Edges)-1].Cursor
+	}
+	return conn, nil
+}
+
+func validateCreateUserInput(input schema.CreateUserInput) error {
+	if strings.TrimSpace(input.Name) == "" {
+		return validationError("name is required")
+	}
+	if _, err := mail.ParseAddress(strings.TrimSpace(input.Email)); err != nil {
+		return validationError("email is not a valid address")
+	}
+	return nil
+}
+
+func parseUserID(id string) (uuid.UUID, error) {
+	userID, err := uuid.FromString(id)
+	if err != nil {
+		return uuid.Nil, validationError("invalid user ID")
+	}
+	return userID, nil
+}
+
+// bulkUserPayload builds the payload of a bulk mutation. When the
+// transaction was rolled back the items that did not fail are reported as
+// rolled back, since none of their changes were kept.
+func bulkUserPayload(results []*schema.BulkUserResult, partial, failed bool) *schema.BulkUserPayload {
+	committed := partial || !failed
+	if !committed {
+		for _, res := range results {
+			if res.Error == nil {
+				res.User = nil
+				res.Error = &schema.UserError{
+					Code:    "ROLLED_BACK",
+					Message: "not applied because another item failed",
+				}
+			}
+		}
+	}
+	return &schema.BulkUserPayload{Committed: committed, Results: results}
+}
+
+// toUserError converts the error of a single bulk item to the error
+// reported to the client, hiding unexpected errors.
+func toUserError(ctx context.Context, err error) *schema.UserError {
+	switch err.(type) {
+	case validationError:
+		return &schema.UserError{Code: "INVALID_INPUT", Message: err.Error()}
+	}
+
+	switch err {
+	case model.ErrEmailTaken:
+		return &schema.UserError{Code: "EMAIL_TAKEN", Message: err.Error()}
+	case model.ErrUserNotFound:
+		return &schema.UserError{Code: "NOT_FOUND", Message: err.Error()}
+	}
+
+	logger(ctx).Error("bulk user operation failed", zap.Error(err))
+	return &schema.UserError{Code: "INTERNAL", Message: "internal server error"}
+}
+
+func userToSchema(u *model.User) *schema.User {
+	email := u.Email
+	return &schema.User{
+		ID:            u.ID.String(),
+		Name:          u.Name,
+		Email:         &email,
+		EmailVerified: u.EmailVerifiedAt != nil,
+	}
+}
+
+const cursorPrefix = "offset:"
+
+// encodeCursor returns the opaque cursor pointing right after the n-th
+// result of a paginated query.
+func encodeCursor(n int) string {
+	return base64.StdEncoding.EncodeToString([]byte(cursorPrefix + strconv.Itoa(n)))
+}
+
+func decodeCursor(cursor string) (int, error) {
+	errInvalid := errors.New("invalid cursor")
+	b, err := base64.StdEncoding.DecodeString(cursor)
+	if err != nil || !strings.HasPrefix(string(b), cursorPrefix) {
+		return 0, errInvalid
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(string(b), cursorPrefix))
+	if err != nil || n < 0 {
+		return 0, errInvalid
+	}
+	return n, nil
 }
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/caquillo07/graphql-server-demo/pkg/auth"
+	"github.com/caquillo07/graphql-server-demo/pkg/gqlgen/schema"
+	"github.com/caquillo07/graphql-server-demo/pkg/model"
+)
+
+func TestCreateUsers(t *testing.T) {
+	tests := []struct {
+		name    string
+		partial bool
+		// emails of the inputs, taken@example.com is already in use
+		emails        []string
+		wantCommitted bool
+		wantCodes     []string
+		wantUsers     int
+	}{
+		{
+			name:          "all valid",
+			emails:        []string{"a@example.com", "b@example.com"},
+			wantCommitted: true,
+			wantCodes:     []string{"", ""},
+			wantUsers:     3,
+		},
+		{
+			name:      "invalid input rolls back",
+			emails:    []string{"a@example.com", "not an email"},
+			wantCodes: []string{"ROLLED_BACK", "INVALID_INPUT"},
+			wantUsers: 1,
+		},
+		{
+			name:      "storage error rolls back",
+			emails:    []string{"a@example.com", "taken@example.com"},
+			wantCodes: []string{"ROLLED_BACK", "EMAIL_TAKEN"},
+			wantUsers: 1,
+		},
+		{
+			name:          "partial keeps the valid items",
+			partial:       true,
+			emails:        []string{"a@example.com", "not an email", "taken@example.com"},
+			wantCommitted: true,
+			wantCodes:     []string{"", "INVALID_INPUT", "EMAIL_TAKEN"},
+			wantUsers:     2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, testConfig())
+			ctx := context.Background()
+			if err := s.users.CreateUser(ctx, &model.User{Name: "Taken", Email: "taken@example.com"}); err != nil {
+				t.Fatal(err)
+			}
+
+			inputs := make([]*schema.CreateUserInput, len(tt.emails))
+			for i, email := range tt.emails {
+				inputs[i] = &schema.CreateUserInput{Name: "User", Email: email}
+			}
+			payload, err := s.CreateUsers(ctx, inputs, &tt.partial)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if payload.Committed != tt.wantCommitted {
+				t.Errorf("committed = %v, want %v", payload.Committed, tt.wantCommitted)
+			}
+			for i, res := range payload.Results {
+				code := ""
+				if res.Error != nil {
+					code = res.Error.Code
+				}
+				if res.Index != i || code != tt.wantCodes[i] || (code == "") != (res.User != nil) {
+					t.Errorf("result %d = index %d, error %q, user %v, want error %q", i, res.Index, code, res.User, tt.wantCodes[i])
+				}
+			}
+			users, err := s.users.ListUsers(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(users) != tt.wantUsers {
+				t.Errorf("%d users stored, want %d", len(users), tt.wantUsers)
+			}
+		})
+	}
+}
+
+func TestDeleteUsers(t *testing.T) {
+	for _, partial := range []bool{false, true} {
+		s := newTestServer(t, testConfig())
+		ctx := context.Background()
+		user := &model.User{Name: "User", Email: "user@example.com"}
+		if err := s.users.CreateUser(ctx, user); err != nil {
+			t.Fatal(err)
+		}
+
+		ids := []string{user.ID.String(), "123e4567-e89b-12d3-a456-426655440000"}
+		payload, err := s.DeleteUsers(ctx, ids, &partial)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if payload.Results[1].Error == nil || payload.Results[1].Error.Code != "NOT_FOUND" {
+			t.Errorf("partial %v: unknown user result = %+v, want NOT_FOUND", partial, payload.Results[1])
+		}
+
+		users, err := s.users.ListUsers(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the existing user is only deleted when the failure of the other
+		// one does not roll everything back
+		if deleted := len(users) == 0; deleted != partial || payload.Committed != partial {
+			t.Errorf("partial %v: deleted = %v, committed = %v", partial, deleted, payload.Committed)
+		}
+	}
+}
+
+func TestCreateUsersRequiresAdmin(t *testing.T) {
+	s := newTestServer(t, testConfig())
+	w := postGraphQL(t, s, "192.0.2.1:1234", nil,
+		`mutation { createUsers(inputs: [{name: "a", email: "a@example.com"}]) { committed } }`, nil)
+	resp := decodeResponse(t, w)
+	if len(resp.Errors) != 1 || resp.Errors[0].Extensions["code"] != errForbidden.code {
+		t.Errorf("anonymous createUsers errors = %+v, want %s", resp.Errors, errForbidden.code)
+	}
+	if users, _ := s.users.ListUsers(context.Background()); len(users) != 0 {
+		t.Errorf("anonymous createUsers stored %d users", len(users))
+	}
+}
+
+func TestCreateUserLimitsAnonymousClients(t *testing.T) {
+	s := newTestServer(t, testConfig())
+	create := func(ctx context.Context, email string) error {
+		hc := &httpContext{r: &http.Request{RemoteAddr: "192.0.2.1:1234"}}
+		ctx = context.WithValue(ctx, httpContextKey{}, hc)
+		_, err := s.CreateUser(ctx, schema.CreateUserInput{Name: "User", Email: email})
+		return err
+	}
+
+	for i := 0; i < createUserLimit.Burst; i++ {
+		if err := create(context.Background(), string(rune('a'+i))+"@example.com"); err != nil {
+			t.Fatalf("user %d: %v", i, err)
+		}
+	}
+	if err := create(context.Background(), "over@example.com"); err != errRateLimited {
+		t.Errorf("user past the limit: error = %v, want %v", err, errRateLimited)
+	}
+
+	// authenticated callers are not limited
+	ctx := auth.WithPrincipal(context.Background(), &auth.Principal{Type: auth.PrincipalUser, Subject: "user"})
+	if err := create(ctx, "user@example.com"); err != nil {
+		t.Errorf("authenticated user past the limit: %v", err)
+	}
+}
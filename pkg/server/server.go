@@ -6,15 +6,24 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"sync/atomic"
+	"syscall"
 	"time"
 
+	"github.com/99designs/gqlgen/graphql"
 	"github.com/99designs/gqlgen/handler"
 	"github.com/go-chi/chi"
 	"github.com/jinzhu/gorm"
 	"go.uber.org/zap"
 
 	"github.com/caquillo07/graphql-server-demo/conf"
+	"github.com/caquillo07/graphql-server-demo/pkg/auth"
+	"github.com/caquillo07/graphql-server-demo/pkg/federation"
 	gqlServer "github.com/caquillo07/graphql-server-demo/pkg/gqlgen/server"
+	"github.com/caquillo07/graphql-server-demo/pkg/mail"
+	"github.com/caquillo07/graphql-server-demo/pkg/model"
+	"github.com/caquillo07/graphql-server-demo/pkg/ratelimit"
+	"github.com/caquillo07/graphql-server-demo/pkg/tracing"
 )
 
 // Server the server to be used in the application
@@ -23,55 +32,230 @@ type Server interface {
 }
 
 type server struct {
-	db           *gorm.DB
-	httpServer   *http.Server
-	config       conf.Config
-	closeTimeout time.Duration
+	gqlServer.Federation
+
+	db                 *gorm.DB
+	users              model.UserRepository
+	idempotencyRecords model.IdempotencyRepository
+	apiKeys            model.APIKeyRepository
+	sessions           model.SessionRepository
+	userTokens         model.UserTokenRepository
+	auditRecords       model.AuditRepository
+	httpServer         *http.Server
+	adminServer        *http.Server
+	config             conf.Config
+	closeTimeout       time.Duration
+	schema             graphql.ExecutableSchema
+	sdl                string
+	jwtVerifier        *auth.JWTVerifier
+	mailer             mail.Mailer
+	oidc               *auth.OIDCProvider
+	loginThrottle      *auth.LoginThrottle
+	certs              *certReloader
+	queryLogger        *zap.Logger
+	metrics            *serverMetrics
+	tracer             *tracing.Tracer
+
+	// shuttingDown is set, atomically, once the graceful shutdown starts
+	shuttingDown int32
+
+	// stopped is closed once the graceful shutdown is done
+	stopped chan struct{}
+
+	readinessChecks []readinessCheck
+
+	idempotencyLocks keyLocks
+	apiKeyUsage      usageTracker
+	sessionUsage     usageTracker
+	sessionConns     sessionConns
+	totpChallenges   totpChallenges
+	rateLimiter      ratelimit.Limiter
+	corsOrigins      *allowedOrigins
 }
 
-// NewGQLServerWithCloseTimeout returns a server with a custom timeout on closing
-func NewGQLServerWithCloseTimeout(config conf.Config, timeout time.Duration) Server {
+// NewGQLServerWithCloseTimeout returns a server with a custom timeout on
+// closing. When db is nil the users are kept in memory.
+func NewGQLServerWithCloseTimeout(config conf.Config, db *gorm.DB, timeout time.Duration) (Server, error) {
 	r := chi.NewRouter()
 	srv := &server{
-		httpServer:   &http.Server{Addr: ":" + config.Server.Port, Handler: r},
-		config:       config,
-		closeTimeout: timeout,
+		db: db,
+		httpServer: &http.Server{
+			Addr:           ":" + config.Server.Port,
+			Handler:        r,
+			ReadTimeout:    config.Server.ReadTimeout,
+			WriteTimeout:   config.Server.WriteTimeout,
+			IdleTimeout:    config.Server.IdleTimeout,
+			MaxHeaderBytes: config.Server.MaxHeaderBytes,
+		},
+		config:        config,
+		closeTimeout:  timeout,
+		loginThrottle: newLoginThrottle(config),
+		corsOrigins:   newAllowedOrigins(config.Server.CORS.AllowedOrigins),
+		metrics:       newServerMetrics(db),
+		stopped:       make(chan struct{}),
+	}
+	srv.adminServer = srv.newAdminServer()
+
+	var err error
+	if srv.tracer, err = newTracer(config); err != nil {
+		return nil, err
+	}
+	r.Use(withRequestID)
+	if config.Server.AccessLog {
+		r.Use(accessLog)
+	}
+	if srv.tracer != nil {
+		r.Use(srv.traceRequest)
+	}
+	r.Use(recoverPanic, srv.countInFlight, securityHeaders, srv.limitBody)
+	if config.Server.CORS.Enabled {
+		c, err := newCORS(config, srv.corsOrigins)
+		if err != nil {
+			return nil, err
+		}
+		r.Use(c.Handler)
+	}
+	if db != nil {
+		srv.users = model.NewPostgresUserRepository(db)
+		srv.idempotencyRecords = model.NewPostgresIdempotencyRepository(db)
+		srv.apiKeys = model.NewPostgresAPIKeyRepository(db)
+		srv.sessions = model.NewPostgresSessionRepository(db)
+		srv.userTokens = model.NewPostgresUserTokenRepository(db)
+		srv.auditRecords = model.NewPostgresAuditRepository(db)
+	} else {
+		srv.users = model.NewMemoryUserRepository()
+		srv.idempotencyRecords = model.NewMemoryIdempotencyRepository()
+		srv.apiKeys = model.NewMemoryAPIKeyRepository()
+		srv.sessions = model.NewMemorySessionRepository()
+		srv.userTokens = model.NewMemoryUserTokenRepository()
+		srv.auditRecords = model.NewMemoryAuditRepository()
+	}
+
+	if srv.jwtVerifier, err = newJWTVerifier(config); err != nil {
+		return nil, err
+	}
+	if srv.mailer, err = newMailer(config); err != nil {
+		return nil, err
+	}
+	if srv.oidc, err = newOIDCProvider(config); err != nil {
+		return nil, err
+	}
+	if srv.certs, err = newCertReloader(config); err != nil {
+		return nil, err
+	}
+	if srv.httpServer.TLSConfig, err = newTLSConfig(config, srv.certs); err != nil {
+		return nil, err
 	}
 
+	srv.readinessChecks = srv.newReadinessChecks()
+	r.Get("/healthz", healthz)
+	r.Get("/readyz", srv.readyz(false))
+
 	if config.GraphQL.Playground {
-		r.Get("/playground", handler.Playground("GraphQL playground", "/graphql"))
+		r.Get("/playground", withPlaygroundCSP(handler.Playground("GraphQL playground", "/graphql")))
 	}
 
-	gql := handler.GraphQL(
-		gqlServer.NewExecutableSchema(gqlServer.Config{Resolvers: srv}),
+	srv.Federation = gqlServer.Federation{Resolver: srv}
+	es := gqlServer.NewExecutableSchema(gqlServer.Config{
+		Resolvers: srv,
+		Directives: gqlServer.DirectiveRoot{
+			HasRole:         srv.hasRole,
+			NoImpersonation: srv.noImpersonation,
+		},
+	})
+	srv.schema = es
+	srv.sdl = federation.PrintSDL(es.Schema())
+
+	var options []handler.Option
+	if config.GraphQL.LogQueries {
+		srv.queryLogger = newQueryLogger(config)
+		options = append(options, handler.RequestMiddleware(srv.logOperation))
+	}
+	if srv.tracer != nil {
+		options = append(options,
+			handler.RequestMiddleware(srv.traceOperation),
+			handler.ResolverMiddleware(srv.traceResolver),
+		)
+	}
+	options = append(options,
+		handler.Tracer(debugTracer{always: config.GraphQL.DebugExtensions}),
+		handler.RecoverFunc(recoverResolver),
+		handler.RequestMiddleware(srv.measureOperation),
+		handler.ResolverMiddleware(srv.measureResolver),
+		handler.WebsocketUpgrader(srv.websocketUpgrader()),
+		handler.WebsocketInitFunc(srv.websocketInit),
+		handler.RequestMiddleware(srv.rateLimitOperation),
+		handler.RequestMiddleware(srv.operationTimeout),
+		handler.RequestMiddleware(srv.auditImpersonation),
 	)
-	r.Post("/graphql", gql)
+	gql := handler.GraphQL(measuredSchema{ExecutableSchema: es, subscriptions: srv.metrics.subscriptions}, options...)
+	r.With(srv.authenticate, srv.rateLimit, srv.idempotency, withHTTPContext).Post("/graphql", gql)
+	r.With(srv.authenticate, srv.rateLimit, withHTTPContext, trackWebsocket).Get("/graphql", gql)
 
-	return srv
+	if srv.oidc != nil {
+		r.Get("/auth/oidc/login", srv.oidcLogin)
+		r.With(withHTTPContext).Get("/auth/oidc/callback", srv.oidcCallback)
+	}
+
+	return srv, nil
 }
 
 // NewGQLServer creates and returns a new server instance for the application
-func NewGQLServer(config conf.Config) Server {
-	return NewGQLServerWithCloseTimeout(config, 10*time.Second)
+func NewGQLServer(config conf.Config, db *gorm.DB) (Server, error) {
+	return NewGQLServerWithCloseTimeout(config, db, 10*time.Second)
 }
 
 func (s *server) Serve() error {
 	s.applyGracefulShutdown()
+	go s.purgeIdempotencyRecords(time.Hour)
+	go s.flushUsage(30 * time.Second)
+	go s.pruneLoginFailures(time.Minute)
+	go s.pruneRateLimits(time.Minute)
+
+	if s.adminServer != nil {
+		go s.serveAdmin()
+	}
 
-	startMsg := "listening on http://localhost:%s"
+	scheme := "http"
+	if s.certs != nil {
+		scheme = "https"
+		if err := s.certs.watch(); err != nil {
+			return err
+		}
+	}
+
+	startMsg := "listening on %s://localhost:%s"
 	if s.config.GraphQL.Playground {
-		startMsg = "connect to http://localhost:%s/playground for GraphQL playground"
+		startMsg = "connect to %s://localhost:%s/playground for GraphQL playground"
+	}
+	zap.L().Info(fmt.Sprintf(startMsg, scheme, s.config.Server.Port))
+	var err error
+	if s.certs != nil {
+		err = s.httpServer.ListenAndServeTLS("", "")
+	} else {
+		err = s.httpServer.ListenAndServe()
+	}
+	if err == http.ErrServerClosed {
+		// let the shutdown finish, the spans still queued are lost otherwise
+		<-s.stopped
 	}
-	zap.L().Info(fmt.Sprintf(startMsg, s.config.Server.Port))
-	return s.httpServer.ListenAndServe()
+	return err
 }
 
 func (s *server) applyGracefulShutdown() {
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	go func() {
 		<-c
 
+		// fail the readiness checks first and give the load balancer time
+		// to notice, requests keep being served meanwhile
+		atomic.StoreInt32(&s.shuttingDown, 1)
+		if delay := s.config.Server.DrainDelay; delay > 0 {
+			zap.L().Info("draining before shutting down", zap.Duration("delay", delay))
+			time.Sleep(delay)
+		}
+
 		// sig is a ^C, handle it
 		// create context with timeout
 		ctx, cancel := context.WithTimeout(context.Background(), s.closeTimeout)
@@ -82,6 +266,17 @@ func (s *server) applyGracefulShutdown() {
 		if err := s.httpServer.Shutdown(ctx); err != nil {
 			zap.L().Error("error when shutting down server", zap.Error(err))
 		}
+		if s.adminServer != nil {
+			if err := s.adminServer.Shutdown(ctx); err != nil {
+				zap.L().Error("error when shutting down admin server", zap.Error(err))
+			}
+		}
+		if s.tracer != nil {
+			if err := s.tracer.Shutdown(ctx); err != nil {
+				zap.L().Error("error when flushing spans", zap.Error(err))
+			}
+		}
+		close(s.stopped)
 
 		// verify, in worst case call cancel via defer
 		select {
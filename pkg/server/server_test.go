@@ -0,0 +1,70 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/caquillo07/graphql-server-demo/conf"
+)
+
+// testConfig is the configuration the tests start from, with nothing rate
+// limited and the emails only logged.
+func testConfig() conf.Config {
+	var config conf.Config
+	config.GraphQL.IdempotencyTTL = time.Hour
+	config.Auth.SessionTTL = time.Hour
+	config.Auth.EmailVerificationTTL = time.Hour
+	config.Auth.PasswordResetTTL = time.Hour
+	config.Mail.Driver = "log"
+	return config
+}
+
+// newTestServer returns a server keeping everything in memory.
+func newTestServer(t *testing.T, config conf.Config) *server {
+	srv, err := NewGQLServer(config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return srv.(*server)
+}
+
+type testResponse struct {
+	Data   map[string]json.RawMessage `json:"data"`
+	Errors []struct {
+		Message    string                 `json:"message"`
+		Extensions map[string]interface{} `json:"extensions"`
+	} `json:"errors"`
+}
+
+// postGraphQL sends the operation to /graphql from the remote address, with
+// the headers set on top of the JSON content type.
+func postGraphQL(t *testing.T, s *server, remoteAddr string, header http.Header, query string, variables map[string]interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	body, err := json.Marshal(graphqlRequest{Query: query, Variables: variables})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/graphql", bytes.NewReader(body))
+	r.RemoteAddr = remoteAddr
+	for name, values := range header {
+		r.Header[name] = values
+	}
+	r.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	s.httpServer.Handler.ServeHTTP(w, r)
+	return w
+}
+
+func decodeResponse(t *testing.T, w *httptest.ResponseRecorder) testResponse {
+	t.Helper()
+	var resp testResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("response %q is not JSON: %v", w.Body.String(), err)
+	}
+	return resp
+}
@@ -0,0 +1,201 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"go.uber.org/zap"
+
+	"github.com/caquillo07/graphql-server-demo/pkg/auth"
+	"github.com/caquillo07/graphql-server-demo/pkg/gqlgen/schema"
+	"github.com/caquillo07/graphql-server-demo/pkg/model"
+)
+
+const (
+	minPasswordLength = 8
+	maxPasswordLength = 256
+)
+
+var (
+	errInvalidCredentials = &codedError{code: "INVALID_CREDENTIALS", message: "invalid email or password"}
+	errUnauthenticated    = &codedError{code: "UNAUTHENTICATED", message: "not logged in"}
+)
+
+// dummyPasswordHash is checked against when logging in with an unknown
+// email, so the response time does not tell whether the account exists.
+var dummyPasswordHash = struct {
+	once sync.Once
+	hash string
+}{}
+
+func (s *server) Signup(ctx context.Context, name string, email string, password string) (*schema.AuthPayload, error) {
+	input := schema.CreateUserInput{Name: name, Email: email}
+	if err := validateCreateUserInput(input); err != nil {
+		return nil, err
+	}
+	if err := validatePassword(password); err != nil {
+		return nil, err
+	}
+
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+	user := &model.User{
+		Name:         strings.TrimSpace(name),
+		Email:        strings.TrimSpace(email),
+		PasswordHash: hash,
+	}
+	if err := s.users.CreateUser(ctx, user); err != nil {
+		return nil, err
+	}
+
+	// a failing mailer does not fail the signup, the user can ask for the
+	// verification email again
+	if s.mailer != nil {
+		if err := s.sendEmailVerification(ctx, user); err != nil {
+			logger(ctx).Error("failed to send email verification", zap.Error(err))
+		}
+	}
+	return s.startSession(ctx, user)
+}
+
+func (s *server) Login(ctx context.Context, email string, password string) (*schema.LoginPayload, error) {
+	account := loginAccount(email)
+	var ip string
+	if hc, ok := httpContextFrom(ctx); ok {
+		ip = clientIP(hc.r)
+	}
+	attempt, err := s.throttleLogin(ctx, account, ip)
+	if err != nil {
+		return nil, err
+	}
+	defer attempt.release()
+
+	user, err := s.users.FindUserByEmail(ctx, strings.TrimSpace(email))
+	if err == model.ErrUserNotFound {
+		dummyPasswordHash.once.Do(func() {
+			dummyPasswordHash.hash, _ = auth.HashPassword("dummy password")
+		})
+		auth.CheckPassword(password, dummyPasswordHash.hash)
+		attempt.failed()
+		return nil, errInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if user.PasswordHash == "" || !auth.CheckPassword(password, user.PasswordHash) {
+		attempt.failed()
+		return nil, errInvalidCredentials
+	}
+
+	if user.TOTPEnabled {
+		challenge, err := s.startTOTPChallenge(user)
+		if err != nil {
+			return nil, err
+		}
+		return &schema.LoginPayload{TotpChallenge: &challenge}, nil
+	}
+	attempt.succeeded()
+	payload, err := s.startSession(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	return &schema.LoginPayload{Session: payload}, nil
+}
+
+func (s *server) Logout(ctx context.Context) (bool, error) {
+	principal, ok := auth.PrincipalFromContext(ctx)
+	if !ok || principal.SessionID == "" {
+		return false, errUnauthenticated
+	}
+
+	sessionID, err := uuid.FromString(principal.SessionID)
+	if err != nil {
+		return false, err
+	}
+	if err := s.sessions.RevokeSession(ctx, sessionID); err != nil && err != model.ErrSessionNotFound {
+		return false, err
+	}
+	s.sessionConns.close(principal.SessionID)
+
+	if s.config.Auth.SessionCookie.Enabled {
+		cookie := s.newSessionCookie("", time.Unix(0, 0))
+		cookie.MaxAge = -1
+		setCookie(ctx, cookie)
+	}
+	return true, nil
+}
+
+// startSession creates a new session for the user, setting the session
+// cookie when enabled.
+func (s *server) startSession(ctx context.Context, user *model.User) (*schema.AuthPayload, error) {
+	token, hash, err := auth.GenerateSessionToken()
+	if err != nil {
+		return nil, err
+	}
+
+	session := &model.Session{
+		UserID:    user.ID,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(s.config.Auth.SessionTTL),
+	}
+	if hc, ok := httpContextFrom(ctx); ok {
+		session.UserAgent = hc.r.UserAgent()
+		session.IP = clientIP(hc.r)
+	}
+	if err := s.sessions.CreateSession(ctx, session); err != nil {
+		return nil, err
+	}
+
+	if s.config.Auth.SessionCookie.Enabled {
+		setCookie(ctx, s.newSessionCookie(token, session.ExpiresAt))
+	}
+	return &schema.AuthPayload{
+		Token:     token,
+		ExpiresAt: session.ExpiresAt,
+		User:      userToSchema(user),
+	}, nil
+}
+
+func (s *server) newSessionCookie(value string, expires time.Time) *http.Cookie {
+	return &http.Cookie{
+		Name:     s.config.Auth.SessionCookie.Name,
+		Value:    value,
+		Path:     "/",
+		Domain:   s.config.Auth.SessionCookie.Domain,
+		Expires:  expires,
+		Secure:   s.config.Auth.SessionCookie.Secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// sessionCookie returns the session cookie of the request, if cookies are
+// enabled and the request has one.
+func (s *server) sessionCookie(r *http.Request) *http.Cookie {
+	if !s.config.Auth.SessionCookie.Enabled {
+		return nil
+	}
+	cookie, err := r.Cookie(s.config.Auth.SessionCookie.Name)
+	if err != nil || cookie.Value == "" {
+		return nil
+	}
+	return cookie
+}
+
+func validatePassword(password string) error {
+	if len(password) < minPasswordLength {
+		return validationError(fmt.Sprintf("password must be at least %d characters long", minPasswordLength))
+	}
+	if len(password) > maxPasswordLength {
+		return validationError(fmt.Sprintf("password must be at most %d characters long", maxPasswordLength))
+	}
+	return nil
+}
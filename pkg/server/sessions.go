@@ -0,0 +1,243 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/99designs/gqlgen/handler"
+	"github.com/gofrs/uuid"
+
+	"github.com/caquillo07/graphql-server-demo/pkg/auth"
+	"github.com/caquillo07/graphql-server-demo/pkg/gqlgen/schema"
+	"github.com/caquillo07/graphql-server-demo/pkg/model"
+)
+
+var errSessionNotFound = &codedError{code: "NOT_FOUND", message: "session not found"}
+
+func (s *server) MySessions(ctx context.Context) ([]*schema.Session, error) {
+	user, err := s.currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.listSessions(ctx, user.ID)
+}
+
+func (s *server) Sessions(ctx context.Context, obj *schema.User) ([]*schema.Session, error) {
+	userID, err := parseUserID(obj.ID)
+	if err != nil {
+		return nil, err
+	}
+	return s.listSessions(ctx, userID)
+}
+
+func (s *server) RevokeSession(ctx context.Context, id string) (bool, error) {
+	principal, ok := auth.PrincipalFromContext(ctx)
+	if !ok {
+		return false, errUnauthenticated
+	}
+	sessionID, err := uuid.FromString(id)
+	if err != nil {
+		return false, errSessionNotFound
+	}
+
+	// sessions of other users are not found rather than forbidden, so
+	// their IDs cannot be probed
+	session, err := s.sessions.GetSession(ctx, sessionID)
+	if err == model.ErrSessionNotFound {
+		return false, errSessionNotFound
+	}
+	if err != nil {
+		return false, err
+	}
+	isOwner := principal.Type == auth.PrincipalUser && principal.Subject == session.UserID.String()
+	if !isOwner && !principal.HasRole(auth.RoleAdmin) {
+		return false, errSessionNotFound
+	}
+
+	err = s.sessions.RevokeSession(ctx, sessionID)
+	if err == model.ErrSessionNotFound {
+		return false, errSessionNotFound
+	}
+	if err != nil {
+		return false, err
+	}
+	s.sessionConns.close(session.ID.String())
+	return true, nil
+}
+
+func (s *server) RevokeAllSessions(ctx context.Context) (int, error) {
+	user, err := s.currentUser(ctx)
+	if err != nil {
+		return 0, err
+	}
+	ids, err := s.sessions.RevokeUserSessions(ctx, user.ID)
+	if err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		s.sessionConns.close(id.String())
+	}
+	return len(ids), nil
+}
+
+func (s *server) listSessions(ctx context.Context, userID uuid.UUID) ([]*schema.Session, error) {
+	sessions, err := s.sessions.ListSessions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	principal, _ := auth.PrincipalFromContext(ctx)
+	result := make([]*schema.Session, len(sessions))
+	for i, session := range sessions {
+		result[i] = sessionToSchema(session, principal)
+	}
+	return result, nil
+}
+
+func sessionToSchema(session *model.Session, principal *auth.Principal) *schema.Session {
+	return &schema.Session{
+		ID:         session.ID.String(),
+		UserAgent:  session.UserAgent,
+		IP:         session.IP,
+		CreatedAt:  session.CreatedAt,
+		LastSeenAt: session.LastSeenAt,
+		ExpiresAt:  session.ExpiresAt,
+		Current:    principal != nil && principal.SessionID == session.ID.String(),
+	}
+}
+
+// websocketInit authenticates websocket connections that send their
+// credentials in the connection_init payload, as browsers cannot set
+// headers on them. Connections authenticated with a session are closed as
+// soon as the session is revoked, ending their subscriptions and the
+// operations they would start after.
+func (s *server) websocketInit(ctx context.Context, payload handler.InitPayload) (context.Context, error) {
+	if header := payload.Authorization(); header != "" {
+		principal, err := s.authenticateBearer(ctx, header)
+		if err != nil {
+			// charged like failures to authenticate over HTTP
+			if hc, ok := httpContextFrom(ctx); ok {
+				key := "ip:" + clientIP(hc.r)
+				if res, limited := s.chargeRateLimit(key, s.config.GraphQL.RateLimit.Anonymous, 1); limited && !res.Allowed {
+					return nil, errRateLimited
+				}
+			}
+			return nil, err
+		}
+		ctx = auth.WithPrincipal(ctx, principal)
+	}
+
+	principal, ok := auth.PrincipalFromContext(ctx)
+	if !ok || principal.SessionID == "" {
+		return ctx, nil
+	}
+	conn, ok := ctx.Value(websocketConnKey{}).(*websocketConn)
+	if !ok {
+		return nil, errors.New("websocket connection is not tracked")
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	s.sessionConns.add(ctx, principal.SessionID, func() {
+		// gqlgen does not watch the context of the connection, closing
+		// the socket is what stops it reading more operations
+		cancel()
+		conn.close()
+	})
+	return ctx, nil
+}
+
+type websocketConnKey struct{}
+
+// websocketConn is the connection hijacked by a websocket upgrade.
+type websocketConn struct {
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func (c *websocketConn) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn != nil {
+		_ = c.conn.Close()
+	}
+}
+
+// trackWebsocket keeps the connection of websocket upgrades, so it can be
+// closed when the session it was authenticated with is revoked.
+func trackWebsocket(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		conn := &websocketConn{}
+		ctx := context.WithValue(r.Context(), websocketConnKey{}, conn)
+		next.ServeHTTP(&hijackWriter{ResponseWriter: w, conn: conn}, r.WithContext(ctx))
+	})
+}
+
+// hijackWriter hands the hijacked connection over to the websocketConn.
+type hijackWriter struct {
+	http.ResponseWriter
+	conn *websocketConn
+}
+
+func (w *hijackWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response does not support hijacking")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err == nil {
+		w.conn.mu.Lock()
+		w.conn.conn = conn
+		w.conn.mu.Unlock()
+	}
+	return conn, rw, err
+}
+
+// sessionConns tracks the open websocket connections of each session, so
+// they can be closed when the session is revoked.
+type sessionConns struct {
+	mu    sync.Mutex
+	next  int
+	conns map[string]map[int]func()
+}
+
+// add registers the connection of the session until its context is done.
+func (c *sessionConns) add(ctx context.Context, sessionID string, close func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conns == nil {
+		c.conns = map[string]map[int]func(){}
+	}
+	if c.conns[sessionID] == nil {
+		c.conns[sessionID] = map[int]func(){}
+	}
+	id := c.next
+	c.next++
+	c.conns[sessionID][id] = close
+
+	go func() {
+		<-ctx.Done()
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		delete(c.conns[sessionID], id)
+		if len(c.conns[sessionID]) == 0 {
+			delete(c.conns, sessionID)
+		}
+	}()
+}
+
+// close closes every connection of the session.
+func (c *sessionConns) close(sessionID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, close := range c.conns[sessionID] {
+		close()
+	}
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/caquillo07/graphql-server-demo/pkg/auth"
+	"github.com/caquillo07/graphql-server-demo/pkg/model"
+)
+
+// dialGraphQL opens a graphql-ws connection authenticated with the session
+// token, returning once the server acknowledged it.
+func dialGraphQL(t *testing.T, url, token string) *websocket.Conn {
+	t.Helper()
+	dialer := websocket.Dialer{Subprotocols: []string{"graphql-ws"}}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(url, "http")+"/graphql", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = conn.WriteJSON(map[string]interface{}{
+		"type":    "connection_init",
+		"payload": map[string]interface{}{"Authorization": "Bearer " + token},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msg struct{ Type string }
+	if err := conn.ReadJSON(&msg); err != nil || msg.Type != "connection_ack" {
+		t.Fatalf("connection_init answered with %q, error %v", msg.Type, err)
+	}
+	return conn
+}
+
+// waitClosed reports whether the server closed the connection before the
+// timeout, skipping the keep alive messages.
+func waitClosed(conn *websocket.Conn, timeout time.Duration) bool {
+	_ = conn.SetReadDeadline(time.Now().Add(timeout))
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			netErr, ok := err.(net.Error)
+			return !ok || !netErr.Timeout()
+		}
+	}
+}
+
+func TestRevokeSessionClosesItsWebsockets(t *testing.T) {
+	s := newTestServer(t, testConfig())
+	ts := httptest.NewServer(s.httpServer.Handler)
+	defer ts.Close()
+
+	ctx := context.Background()
+	user := &model.User{Name: "User", Email: "user@example.com"}
+	if err := s.users.CreateUser(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	revoked, err := s.startSession(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept, err := s.startSession(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	revokedConn := dialGraphQL(t, ts.URL, revoked.Token)
+	defer revokedConn.Close()
+	keptConn := dialGraphQL(t, ts.URL, kept.Token)
+	defer keptConn.Close()
+
+	session, err := s.sessions.FindSessionByTokenHash(ctx, auth.HashSessionToken(revoked.Token))
+	if err != nil {
+		t.Fatal(err)
+	}
+	principalCtx := auth.WithPrincipal(ctx, &auth.Principal{Type: auth.PrincipalUser, Subject: user.ID.String()})
+	if _, err := s.RevokeSession(principalCtx, session.ID.String()); err != nil {
+		t.Fatal(err)
+	}
+
+	if !waitClosed(revokedConn, 2*time.Second) {
+		t.Error("connection of the revoked session is still open")
+	}
+	if waitClosed(keptConn, 100*time.Millisecond) {
+		t.Error("connection of another session was closed")
+	}
+}
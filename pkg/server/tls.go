@@ -0,0 +1,170 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+
+	"github.com/caquillo07/graphql-server-demo/conf"
+	"github.com/caquillo07/graphql-server-demo/pkg/auth"
+)
+
+// certReloadDelay is how long the certificate files must be left alone
+// before they are loaded again
+const certReloadDelay = 500 * time.Millisecond
+
+var (
+	errNoClientCAs     = errors.New("client CA file has no certificates")
+	errClientCAsNeeded = errors.New("server.tls.requireClientCert needs server.tls.clientCAFile")
+	errTLSNeeded       = errors.New("client certificates need server.tls.certFile and keyFile")
+)
+
+// newTLSConfig returns the TLS config of the server, or nil when it serves
+// plain HTTP. Client certificates are verified against the client CAs when
+// configured, and required too when set to.
+func newTLSConfig(config conf.Config, certs *certReloader) (*tls.Config, error) {
+	c := config.Server.TLS
+	if c.RequireClientCert && c.ClientCAFile == "" {
+		return nil, errClientCAsNeeded
+	}
+	if certs == nil {
+		if c.ClientCAFile != "" {
+			return nil, errTLSNeeded
+		}
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: certs.getCertificate,
+	}
+
+	if c.ClientCAFile != "" {
+		pem, err := ioutil.ReadFile(c.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errNoClientCAs
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		if c.RequireClientCert {
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	return tlsConfig, nil
+}
+
+// certReloader holds the server certificate, loading it again when its
+// files change so renewed certificates are served without a restart.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+// newCertReloader loads the certificate, returning nil when no certificate
+// is configured.
+func newCertReloader(config conf.Config) (*certReloader, error) {
+	c := config.Server.TLS
+	if c.CertFile == "" && c.KeyFile == "" {
+		return nil, nil
+	}
+	r := &certReloader{certFile: c.CertFile, keyFile: c.KeyFile}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *certReloader) load() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.cert = &cert
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// watch reloads the certificate whenever something changes in the
+// directories of its files. The directories are watched rather than the
+// files since certificates are usually replaced by renaming new files over
+// them, or swapping a symlink as kubernetes does with mounted secrets. A
+// certificate that fails to load is logged and the previous one kept.
+func (r *certReloader) watch() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	dirs := map[string]bool{filepath.Dir(r.certFile): true, filepath.Dir(r.keyFile): true}
+	for dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			_ = watcher.Close()
+			return err
+		}
+	}
+
+	// the certificate and key are usually replaced one after the other, so
+	// the reload waits for the changes to settle
+	reload := time.AfterFunc(time.Hour, func() {
+		if err := r.load(); err != nil {
+			zap.L().Warn("failed to reload tls certificate", zap.Error(err))
+			return
+		}
+		zap.L().Info("reloaded tls certificate", zap.String("file", r.certFile))
+	})
+	reload.Stop()
+
+	go func() {
+		defer watcher.Close()
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if event.Op != fsnotify.Chmod {
+					reload.Reset(certReloadDelay)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				zap.L().Error("failed to watch tls certificate", zap.Error(err))
+			}
+		}
+	}()
+	return nil
+}
+
+// clientCertPrincipal returns the principal of the verified client
+// certificate of the request, if it has one.
+func clientCertPrincipal(r *http.Request) *auth.Principal {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+	return &auth.Principal{
+		Type:    auth.PrincipalClientCert,
+		Subject: cert.Subject.String(),
+	}
+}
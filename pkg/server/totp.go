@@ -0,0 +1,281 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+
+	"github.com/caquillo07/graphql-server-demo/pkg/auth"
+	"github.com/caquillo07/graphql-server-demo/pkg/gqlgen/schema"
+	"github.com/caquillo07/graphql-server-demo/pkg/model"
+)
+
+const (
+	// totpChallengeTTL is how long a user has to enter their code after
+	// logging in with their password
+	totpChallengeTTL = 5 * time.Minute
+
+	// maxTOTPChallengeAttempts is the number of wrong codes after which a
+	// challenge is dropped and the login has to start over
+	maxTOTPChallengeAttempts = 5
+
+	// recoveryCodeCount is the number of recovery codes given on confirming
+	recoveryCodeCount = 10
+)
+
+var (
+	errInvalidTOTPChallenge = &codedError{code: "INVALID_TOTP_CHALLENGE", message: "login challenge is invalid or expired"}
+	errInvalidTOTPCode      = &codedError{code: "INVALID_TOTP_CODE", message: "invalid code"}
+	errTOTPEnabled          = &codedError{code: "TOTP_ENABLED", message: "TOTP is already enabled"}
+	errTOTPNotEnrolled      = &codedError{code: "TOTP_NOT_ENROLLED", message: "TOTP enrollment has not been started"}
+	errTOTPNotEnabled       = &codedError{code: "TOTP_NOT_ENABLED", message: "TOTP is not enabled"}
+)
+
+func (s *server) LoginTotp(ctx context.Context, challenge string, code string) (*schema.AuthPayload, error) {
+	hash := auth.HashSessionToken(challenge)
+	c, ok := s.totpChallenges.get(hash, time.Now())
+	if !ok {
+		return nil, errInvalidTOTPChallenge
+	}
+
+	var ip string
+	if hc, ok := httpContextFrom(ctx); ok {
+		ip = clientIP(hc.r)
+	}
+	attempt, err := s.throttleLogin(ctx, c.account, ip)
+	if err != nil {
+		return nil, err
+	}
+	defer attempt.release()
+
+	user, err := s.users.GetUser(ctx, c.userID)
+	if err == model.ErrUserNotFound {
+		s.totpChallenges.delete(hash)
+		return nil, errInvalidTOTPChallenge
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ok, err = s.checkSecondFactor(ctx, user, code)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		attempt.failed()
+		if s.totpChallenges.fail(hash) >= maxTOTPChallengeAttempts {
+			s.totpChallenges.delete(hash)
+		}
+		return nil, errInvalidTOTPCode
+	}
+
+	s.totpChallenges.delete(hash)
+	attempt.succeeded()
+	return s.startSession(ctx, user)
+}
+
+func (s *server) EnrollTotp(ctx context.Context) (*schema.TotpEnrollment, error) {
+	user, err := s.currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabled {
+		return nil, errTOTPEnabled
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	user.TOTPSecret = secret
+	if err := s.users.UpdateUser(ctx, user); err != nil {
+		return nil, err
+	}
+	return &schema.TotpEnrollment{
+		Secret: secret,
+		URI:    auth.TOTPURI(s.config.Auth.TOTP.Issuer, user.Email, secret),
+	}, nil
+}
+
+func (s *server) ConfirmTotp(ctx context.Context, code string) ([]string, error) {
+	user, err := s.currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabled {
+		return nil, errTOTPEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, errTOTPNotEnrolled
+	}
+
+	attempt, err := s.throttleSecondFactor(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	defer attempt.release()
+
+	step, ok := auth.ValidateTOTP(user.TOTPSecret, code, time.Now())
+	if !ok {
+		attempt.failed()
+		return nil, errInvalidTOTPCode
+	}
+	codes, hashes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+
+	user.TOTPEnabled = true
+	user.TOTPLastStep = step
+	user.RecoveryCodes = hashes
+	if err := s.users.UpdateUser(ctx, user); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (s *server) DisableTotp(ctx context.Context, code string) (bool, error) {
+	user, err := s.currentUser(ctx)
+	if err != nil {
+		return false, err
+	}
+	if !user.TOTPEnabled {
+		return false, errTOTPNotEnabled
+	}
+
+	attempt, err := s.throttleSecondFactor(ctx, user)
+	if err != nil {
+		return false, err
+	}
+	defer attempt.release()
+
+	ok, err := s.checkSecondFactor(ctx, user, code)
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		attempt.failed()
+		return false, errInvalidTOTPCode
+	}
+
+	user.TOTPSecret = ""
+	user.TOTPEnabled = false
+	user.TOTPLastStep = 0
+	user.RecoveryCodes = nil
+	if err := s.users.UpdateUser(ctx, user); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// checkSecondFactor reports whether the code is a valid TOTP code or an
+// unused recovery code of the user, using it up.
+func (s *server) checkSecondFactor(ctx context.Context, user *model.User, code string) (bool, error) {
+	if step, ok := auth.ValidateTOTP(user.TOTPSecret, code, time.Now()); ok {
+		return s.users.UseTOTPStep(ctx, user.ID, step)
+	}
+	return s.users.UseRecoveryCode(ctx, user.ID, auth.HashRecoveryCode(code))
+}
+
+// throttleSecondFactor reserves an attempt at a code for the logged in
+// user, counted along with their logins so a stolen session cannot guess
+// codes while enrolling or disabling TOTP either.
+func (s *server) throttleSecondFactor(ctx context.Context, user *model.User) (*loginAttempt, error) {
+	var ip string
+	if hc, ok := httpContextFrom(ctx); ok {
+		ip = clientIP(hc.r)
+	}
+	return s.throttleLogin(ctx, loginAccount(user.Email), ip)
+}
+
+// startTOTPChallenge returns the challenge a user with TOTP enabled passes
+// to loginTotp along with their code.
+func (s *server) startTOTPChallenge(user *model.User) (string, error) {
+	token, hash, err := auth.GenerateSessionToken()
+	if err != nil {
+		return "", err
+	}
+	s.totpChallenges.add(hash, &totpChallenge{
+		userID:    user.ID,
+		account:   loginAccount(user.Email),
+		expiresAt: time.Now().Add(totpChallengeTTL),
+	})
+	return token, nil
+}
+
+// currentUser returns the user the request is authenticated as.
+func (s *server) currentUser(ctx context.Context) (*model.User, error) {
+	principal, ok := auth.PrincipalFromContext(ctx)
+	if !ok || principal.Type != auth.PrincipalUser {
+		return nil, errUnauthenticated
+	}
+	userID, err := uuid.FromString(principal.Subject)
+	if err != nil {
+		return nil, errUnauthenticated
+	}
+	user, err := s.users.GetUser(ctx, userID)
+	if err == model.ErrUserNotFound {
+		return nil, errUnauthenticated
+	}
+	return user, err
+}
+
+type totpChallenge struct {
+	userID    uuid.UUID
+	account   string
+	expiresAt time.Time
+	attempts  int
+}
+
+// totpChallenges holds the logins waiting for a second factor, by the hash
+// of their challenge.
+type totpChallenges struct {
+	mu         sync.Mutex
+	challenges map[string]*totpChallenge
+}
+
+func (c *totpChallenges) add(hash string, challenge *totpChallenge) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.challenges == nil {
+		c.challenges = map[string]*totpChallenge{}
+	}
+
+	// drop the expired challenges while at it, there are only ever a few
+	for h, existing := range c.challenges {
+		if time.Now().After(existing.expiresAt) {
+			delete(c.challenges, h)
+		}
+	}
+	c.challenges[hash] = challenge
+}
+
+func (c *totpChallenges) get(hash string, now time.Time) (totpChallenge, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	challenge, ok := c.challenges[hash]
+	if !ok || now.After(challenge.expiresAt) {
+		return totpChallenge{}, false
+	}
+	return *challenge, true
+}
+
+// fail counts a wrong code for the challenge, returning the attempts so far.
+func (c *totpChallenges) fail(hash string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	challenge, ok := c.challenges[hash]
+	if !ok {
+		return 0
+	}
+	challenge.attempts++
+	return challenge.attempts
+}
+
+func (c *totpChallenges) delete(hash string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.challenges, hash)
+}
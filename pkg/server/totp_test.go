@@ -0,0 +1,43 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/caquillo07/graphql-server-demo/pkg/auth"
+	"github.com/caquillo07/graphql-server-demo/pkg/model"
+)
+
+func TestConfirmTotpLocksOutGuesses(t *testing.T) {
+	config := testConfig()
+	config.Auth.Lockout.MaxAccountFailures = 3
+	config.Auth.Lockout.Window = time.Minute
+	config.Auth.Lockout.Duration = time.Minute
+	s := newTestServer(t, config)
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &model.User{Name: "User", Email: "user@example.com", TOTPSecret: secret}
+	if err := s.users.CreateUser(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	ctx := auth.WithPrincipal(context.Background(), &auth.Principal{Type: auth.PrincipalUser, Subject: user.ID.String()})
+
+	for i := 0; i < config.Auth.Lockout.MaxAccountFailures; i++ {
+		if _, err := s.ConfirmTotp(ctx, "abcdef"); err != errInvalidTOTPCode {
+			t.Fatalf("guess %d: error = %v, want %v", i, err, errInvalidTOTPCode)
+		}
+	}
+
+	// even the right code is refused once locked out
+	code, err := auth.TOTPCode(secret, auth.TOTPStep(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ConfirmTotp(ctx, code); err != errLoginLocked {
+		t.Errorf("right code after the lockout: error = %v, want %v", err, errLoginLocked)
+	}
+}
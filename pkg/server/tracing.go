@@ -0,0 +1,102 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/99designs/gqlgen/graphql"
+
+	"github.com/caquillo07/graphql-server-demo/conf"
+	"github.com/caquillo07/graphql-server-demo/pkg/tracing"
+)
+
+// newTracer returns the tracer of the configured exporter, or nil when
+// tracing is off.
+func newTracer(config conf.Config) (*tracing.Tracer, error) {
+	var exporter tracing.Exporter
+	switch config.Tracing.Exporter {
+	case "":
+		return nil, nil
+	case "otlp":
+		exporter = &tracing.OTLPExporter{
+			URL:         config.Tracing.OTLPURL,
+			ServiceName: config.Tracing.ServiceName,
+		}
+	case "stdout":
+		exporter = tracing.NewWriterExporter(os.Stdout)
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", config.Tracing.Exporter)
+	}
+	return tracing.NewTracer(exporter, config.Tracing.SampleRatio), nil
+}
+
+// traceRequest starts the span of each request, continuing the trace of
+// the caller when it sent a traceparent header. Websocket connections are
+// left out, they stay open for as long as the client wants; their
+// operations start traces of their own.
+func (s *server) traceRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		remote, _ := tracing.Extract(r.Header)
+		ctx, span := s.tracer.Start(r.Context(), "HTTP "+r.Method+" "+r.URL.Path, tracing.SpanKindServer, remote)
+		defer span.End()
+		span.SetAttribute("http.method", r.Method)
+		span.SetAttribute("http.target", r.URL.Path)
+
+		sw := &statusWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		next.ServeHTTP(sw, r.WithContext(ctx))
+		span.SetAttribute("http.status_code", sw.statusCode)
+		if sw.statusCode >= http.StatusInternalServerError {
+			span.SetError(errors.New(http.StatusText(sw.statusCode)))
+		}
+	})
+}
+
+// traceOperation records a span for each operation, named after it.
+func (s *server) traceOperation(ctx context.Context, next func(ctx context.Context) []byte) []byte {
+	reqCtx := graphql.GetRequestContext(ctx)
+	name, typ := reqCtx.OperationName, ""
+	if op := reqCtx.Doc.Operations.ForName(reqCtx.OperationName); op != nil {
+		name, typ = op.Name, string(op.Operation)
+	}
+
+	spanName := strings.TrimSpace(typ + " " + name)
+	var span *tracing.Span
+	if tracing.SpanFromContext(ctx) != nil {
+		ctx, span = tracing.StartSpan(ctx, spanName, tracing.SpanKindInternal)
+	} else {
+		ctx, span = s.tracer.Start(ctx, spanName, tracing.SpanKindInternal, tracing.SpanContext{})
+	}
+	defer span.End()
+	span.SetAttribute("graphql.operation.name", name)
+	span.SetAttribute("graphql.operation.type", typ)
+	span.SetAttribute("graphql.document", hashDocument(reqCtx.RawQuery))
+
+	res := next(ctx)
+	if len(reqCtx.Errors) > 0 {
+		span.SetError(reqCtx.Errors[0])
+		span.SetAttribute("graphql.errors", len(reqCtx.Errors))
+	}
+	return res
+}
+
+// traceResolver records a span for each resolver, leaving out the fields
+// read straight from a struct like measureResolver does.
+func (s *server) traceResolver(ctx context.Context, next graphql.Resolver) (interface{}, error) {
+	rc := graphql.GetResolverContext(ctx)
+	if !rc.IsMethod {
+		return next(ctx)
+	}
+	ctx, span := tracing.StartSpan(ctx, rc.Object+"."+rc.Field.Name, tracing.SpanKindInternal)
+	defer span.End()
+	res, err := next(ctx)
+	span.SetError(err)
+	return res, err
+}
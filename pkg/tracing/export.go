@@ -0,0 +1,194 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// OTLPExporter sends spans to an OpenTelemetry collector over OTLP/HTTP,
+// encoded as JSON.
+type OTLPExporter struct {
+	// URL the traces endpoint of the collector, usually ending in
+	// /v1/traces
+	URL string
+
+	// ServiceName the name the spans are reported under
+	ServiceName string
+
+	// Client the HTTP client used to reach the collector,
+	// http.DefaultClient when nil
+	Client *http.Client
+}
+
+// Export sends the spans in one request.
+func (e *OTLPExporter) Export(ctx context.Context, spans []*Span) error {
+	body, err := json.Marshal(otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: otlpAttributes([]Attribute{{Key: "service.name", Value: e.ServiceName}})},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: "github.com/caquillo07/graphql-server-demo/pkg/tracing"},
+			Spans: otlpSpans(spans),
+		}},
+	}}})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, e.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := e.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, res.Body)
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("tracing: collector responded with %s", res.Status)
+	}
+	return nil
+}
+
+// WriterExporter writes each span as a line of JSON, in the same format
+// they are sent over OTLP, for looking at traces locally.
+type WriterExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterExporter returns an exporter writing to w, e.g. os.Stdout.
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{w: w}
+}
+
+// Export writes the spans.
+func (e *WriterExporter) Export(ctx context.Context, spans []*Span) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	enc := json.NewEncoder(e.w)
+	for _, span := range otlpSpans(spans) {
+		if err := enc.Encode(span); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The OTLP JSON encoding, IDs are hex and 64 bit integers strings.
+// https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	TraceState        string          `json:"traceState,omitempty"`
+	Name              string          `json:"name"`
+	Kind              SpanKind        `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            *otlpStatus     `json:"status,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+// otlpStatusError is the status code of failed spans
+const otlpStatusError = 2
+
+func otlpSpans(spans []*Span) []otlpSpan {
+	encoded := make([]otlpSpan, len(spans))
+	for i, s := range spans {
+		s.mu.Lock()
+		encoded[i] = otlpSpan{
+			TraceID:           s.sc.TraceID.String(),
+			SpanID:            s.sc.SpanID.String(),
+			TraceState:        s.sc.TraceState,
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+			Attributes:        otlpAttributes(s.attributes),
+		}
+		if s.parentID != (SpanID{}) {
+			encoded[i].ParentSpanID = s.parentID.String()
+		}
+		if s.err != "" {
+			encoded[i].Status = &otlpStatus{Code: otlpStatusError, Message: s.err}
+		}
+		s.mu.Unlock()
+	}
+	return encoded
+}
+
+func otlpAttributes(attributes []Attribute) []otlpAttribute {
+	encoded := make([]otlpAttribute, len(attributes))
+	for i, a := range attributes {
+		encoded[i].Key = a.Key
+		switch v := a.Value.(type) {
+		case string:
+			encoded[i].Value.StringValue = &v
+		case bool:
+			encoded[i].Value.BoolValue = &v
+		case int:
+			s := strconv.Itoa(v)
+			encoded[i].Value.IntValue = &s
+		case int64:
+			s := strconv.FormatInt(v, 10)
+			encoded[i].Value.IntValue = &s
+		case float64:
+			encoded[i].Value.DoubleValue = &v
+		default:
+			s := fmt.Sprint(v)
+			encoded[i].Value.StringValue = &s
+		}
+	}
+	return encoded
+}
@@ -0,0 +1,41 @@
+package tracing
+
+import (
+	"net/http"
+)
+
+// Transport records a span for each request sent through it, passing the
+// trace on to the server in the traceparent and tracestate headers.
+type Transport struct {
+	// Base the transport sending the requests, http.DefaultTransport when
+	// nil
+	Base http.RoundTripper
+}
+
+// RoundTrip sends the request.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	ctx, span := StartSpan(req.Context(), "HTTP "+req.Method, SpanKindClient)
+	if span == nil {
+		return base.RoundTrip(req)
+	}
+	defer span.End()
+	span.SetAttribute("http.method", req.Method)
+	span.SetAttribute("http.url", req.URL.Scheme+"://"+req.URL.Host+req.URL.Path)
+
+	// requests must not be changed by transports, the headers go on a copy
+	req = req.WithContext(ctx)
+	req.Header = req.Header.Clone()
+	Inject(ctx, req.Header)
+
+	res, err := base.RoundTrip(req)
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+	span.SetAttribute("http.status_code", res.StatusCode)
+	return res, nil
+}
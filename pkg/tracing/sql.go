@@ -0,0 +1,181 @@
+package tracing
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WrapDriver returns a database/sql driver recording a span for every
+// statement run with a traced context, and adding it to the statement log
+// of the context when it has one. Statements in a transaction are given no
+// context by database/sql, they are recorded with the one the transaction
+// was started with.
+func WrapDriver(d driver.Driver) driver.Driver {
+	return &tracedDriver{Driver: d}
+}
+
+type tracedDriver struct {
+	driver.Driver
+}
+
+func (d *tracedDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &tracedConn{Conn: conn}, nil
+}
+
+type tracedConn struct {
+	driver.Conn
+
+	// txCtx the context of the transaction in progress
+	txCtx context.Context
+}
+
+func (c *tracedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	end := c.record(ctx, "BEGIN")
+	var tx driver.Tx
+	var err error
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		tx, err = b.BeginTx(ctx, opts)
+	} else {
+		tx, err = c.Conn.Begin()
+	}
+	end(err)
+	if err != nil {
+		return nil, err
+	}
+	c.txCtx = ctx
+	return &tracedTx{Tx: tx, conn: c}, nil
+}
+
+func (c *tracedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return p.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c *tracedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	end := c.record(ctx, query)
+	res, err := execer.ExecContext(ctx, query, args)
+	end(err)
+	return res, err
+}
+
+func (c *tracedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	end := c.record(ctx, query)
+	rows, err := queryer.QueryContext(ctx, query, args)
+	end(err)
+	return rows, err
+}
+
+func (c *tracedConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+// record starts the span of a statement, named after its first keyword
+// since the statement itself can be long, and returns the func ending it.
+func (c *tracedConn) record(ctx context.Context, query string) func(err error) {
+	if c.txCtx != nil && SpanFromContext(ctx) == nil && statementLogFromContext(ctx) == nil {
+		ctx = c.txCtx
+	}
+	name := "SQL"
+	if fields := strings.Fields(query); len(fields) > 0 {
+		name = strings.ToUpper(fields[0])
+	}
+	_, span := StartSpan(ctx, name, SpanKindClient)
+	span.SetAttribute("db.system", "postgresql")
+	span.SetAttribute("db.statement", query)
+	log := statementLogFromContext(ctx)
+	start := time.Now()
+
+	return func(err error) {
+		if err == driver.ErrSkip {
+			return
+		}
+		span.SetError(err)
+		span.End()
+		log.add(Statement{Query: query, Start: start, Duration: time.Since(start), Err: err})
+	}
+}
+
+type tracedTx struct {
+	driver.Tx
+	conn *tracedConn
+}
+
+func (tx *tracedTx) Commit() error {
+	end := tx.conn.record(context.Background(), "COMMIT")
+	tx.conn.txCtx = nil
+	err := tx.Tx.Commit()
+	end(err)
+	return err
+}
+
+func (tx *tracedTx) Rollback() error {
+	end := tx.conn.record(context.Background(), "ROLLBACK")
+	tx.conn.txCtx = nil
+	err := tx.Tx.Rollback()
+	end(err)
+	return err
+}
+
+// Statement is a statement run through a wrapped driver.
+type Statement struct {
+	Query    string
+	Start    time.Time
+	Duration time.Duration
+	Err      error
+}
+
+// StatementLog collects the statements run with a context, for showing a
+// developer what a request did. It is safe for concurrent use.
+type StatementLog struct {
+	mu         sync.Mutex
+	statements []Statement
+}
+
+// Statements returns the statements run so far, in the order they ended.
+func (l *StatementLog) Statements() []Statement {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]Statement(nil), l.statements...)
+}
+
+func (l *StatementLog) add(statement Statement) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.statements = append(l.statements, statement)
+}
+
+type statementLogKey struct{}
+
+// ContextWithStatementLog returns a copy of the context whose statements
+// are added to the log.
+func ContextWithStatementLog(ctx context.Context, log *StatementLog) context.Context {
+	return context.WithValue(ctx, statementLogKey{}, log)
+}
+
+func statementLogFromContext(ctx context.Context) *StatementLog {
+	log, _ := ctx.Value(statementLogKey{}).(*StatementLog)
+	return log
+}
@@ -0,0 +1,366 @@
+// Package tracing records spans of the work done for a request, following
+// the W3C trace context so traces continue across services, and exports
+// them in batches.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	traceparentHeader = "traceparent"
+	tracestateHeader  = "tracestate"
+
+	// maxBatchSize is the most spans exported at once
+	maxBatchSize = 512
+
+	// maxQueueSize is the most spans waiting to be exported, spans ended
+	// past it are dropped
+	maxQueueSize = 4096
+
+	// batchInterval is how long ended spans wait to be exported at most
+	batchInterval = 5 * time.Second
+)
+
+// TraceID identifies a trace, shared by all its spans.
+type TraceID [16]byte
+
+// SpanID identifies a span within a trace.
+type SpanID [8]byte
+
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+func (id SpanID) String() string  { return hex.EncodeToString(id[:]) }
+
+// SpanContext is the part of a span that is propagated to other services.
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	Sampled    bool
+	TraceState string
+}
+
+// IsValid reports whether the trace and span IDs are set.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+// Traceparent formats the span context as a traceparent header.
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// ParseTraceparent parses a traceparent header, along with its tracestate
+// which is kept as is.
+func ParseTraceparent(traceparent, tracestate string) (SpanContext, bool) {
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return SpanContext{}, false
+	}
+
+	// versions after 00 can add fields, which are ignored
+	if parts[0] == "00" && len(parts) != 4 {
+		return SpanContext{}, false
+	}
+	version, err := hex.DecodeString(parts[0])
+	if err != nil || len(version) != 1 {
+		return SpanContext{}, false
+	}
+
+	var sc SpanContext
+	if n, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil || n != 16 || len(parts[1]) != 32 {
+		return SpanContext{}, false
+	}
+	if n, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil || n != 8 || len(parts[2]) != 16 {
+		return SpanContext{}, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil || len(flags) != 1 {
+		return SpanContext{}, false
+	}
+	if !sc.IsValid() || strings.ToLower(parts[1]) != parts[1] || strings.ToLower(parts[2]) != parts[2] {
+		return SpanContext{}, false
+	}
+	sc.Sampled = flags[0]&1 == 1
+	sc.TraceState = strings.TrimSpace(tracestate)
+	return sc, true
+}
+
+// Extract returns the span context of the traceparent and tracestate
+// headers, if there is a valid one.
+func Extract(h http.Header) (SpanContext, bool) {
+	return ParseTraceparent(h.Get(traceparentHeader), h.Get(tracestateHeader))
+}
+
+// Inject sets the traceparent and tracestate headers of the span in the
+// context, so the service the request is sent to continues the trace.
+func Inject(ctx context.Context, h http.Header) {
+	span := SpanFromContext(ctx)
+	if span == nil {
+		return
+	}
+	h.Set(traceparentHeader, span.sc.Traceparent())
+	if span.sc.TraceState != "" {
+		h.Set(tracestateHeader, span.sc.TraceState)
+	}
+}
+
+// SpanKind tells the role of a span in a trace, the values are the ones
+// OTLP uses.
+type SpanKind int
+
+// Kinds of spans.
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindServer   SpanKind = 2
+	SpanKindClient   SpanKind = 3
+)
+
+// Attribute is a key and value describing a span.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Span is a piece of work within a trace. Spans that are not sampled are
+// still propagated but record nothing. The methods of a nil span do
+// nothing, so callers do not need to check whether tracing is enabled.
+type Span struct {
+	tracer   *Tracer
+	sc       SpanContext
+	parentID SpanID
+	name     string
+	kind     SpanKind
+	start    time.Time
+
+	mu         sync.Mutex
+	end        time.Time
+	attributes []Attribute
+	err        string
+	ended      bool
+}
+
+// SpanContext returns the span context of the span.
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.sc
+}
+
+// SetAttribute records an attribute of the span.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil || !s.sc.Sampled {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attributes = append(s.attributes, Attribute{Key: key, Value: value})
+}
+
+// SetError marks the span as failed with the error.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil || !s.sc.Sampled {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err.Error()
+}
+
+// End ends the span, queueing it to be exported when sampled. Only the
+// first call has any effect.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.mu.Unlock()
+
+	if s.sc.Sampled {
+		s.tracer.enqueue(s)
+	}
+}
+
+type spanKey struct{}
+
+// ContextWithSpan returns a copy of the context carrying the span.
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// SpanFromContext returns the span of the context, nil when it has none.
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// StartSpan starts a child of the span in the context. When the context
+// has no span, nothing is being traced and the span returned is nil.
+func StartSpan(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	parent := SpanFromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	span := parent.tracer.newSpan(name, kind, parent.sc)
+	span.parentID = parent.sc.SpanID
+	return ContextWithSpan(ctx, span), span
+}
+
+// Exporter sends ended spans to wherever they are collected.
+type Exporter interface {
+	Export(ctx context.Context, spans []*Span) error
+}
+
+// Tracer starts the root spans of traces, and exports the spans of the
+// traces it samples in batches.
+type Tracer struct {
+	sampleRatio float64
+	exporter    Exporter
+
+	queue chan *Span
+	done  chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewTracer returns a tracer recording the given ratio of the traces it
+// starts, the traces continued from other services being recorded when
+// they were sampled there.
+func NewTracer(exporter Exporter, sampleRatio float64) *Tracer {
+	t := &Tracer{
+		sampleRatio: sampleRatio,
+		exporter:    exporter,
+		queue:       make(chan *Span, maxQueueSize),
+		done:        make(chan struct{}),
+	}
+	go t.run()
+	return t
+}
+
+// Start starts a span continuing the remote span context, or the root span
+// of a new trace when it is not valid.
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind, remote SpanContext) (context.Context, *Span) {
+	var span *Span
+	if remote.IsValid() {
+		span = t.newSpan(name, kind, remote)
+		span.parentID = remote.SpanID
+	} else {
+		var traceID TraceID
+		randomBytes(traceID[:])
+		span = t.newSpan(name, kind, SpanContext{TraceID: traceID, Sampled: t.sample(traceID)})
+	}
+	return ContextWithSpan(ctx, span), span
+}
+
+// newSpan starts a span in the trace of the span context.
+func (t *Tracer) newSpan(name string, kind SpanKind, parent SpanContext) *Span {
+	sc := parent
+	randomBytes(sc.SpanID[:])
+	return &Span{tracer: t, sc: sc, name: name, kind: kind, start: time.Now()}
+}
+
+// sample decides from the trace ID whether a new trace is recorded, so the
+// decision is the same everywhere the ID is seen.
+func (t *Tracer) sample(id TraceID) bool {
+	if t.sampleRatio >= 1 {
+		return true
+	}
+	if t.sampleRatio <= 0 {
+		return false
+	}
+	return binary.BigEndian.Uint64(id[8:]) < uint64(t.sampleRatio*math.MaxUint64)
+}
+
+func (t *Tracer) enqueue(span *Span) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.closed {
+		return
+	}
+	select {
+	case t.queue <- span:
+	default:
+		zap.L().Warn("dropped span, the export queue is full", zap.String("span", span.name))
+	}
+}
+
+func (t *Tracer) run() {
+	defer close(t.done)
+	ticker := time.NewTicker(batchInterval)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, maxBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := t.exporter.Export(ctx, batch); err != nil {
+			zap.L().Warn("failed to export spans", zap.Int("spans", len(batch)), zap.Error(err))
+		}
+		batch = make([]*Span, 0, maxBatchSize)
+	}
+
+	for {
+		select {
+		case span, ok := <-t.queue:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, span)
+			if len(batch) >= maxBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// Shutdown exports the spans still queued, waiting until it is done or
+// the context is.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	t.mu.Lock()
+	if !t.closed {
+		t.closed = true
+		close(t.queue)
+	}
+	t.mu.Unlock()
+
+	select {
+	case <-t.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func randomBytes(b []byte) {
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("tracing: failed to generate id: %v", err))
+	}
+}